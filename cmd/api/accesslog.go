@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const redacted = "[REDACTED]"
+
+// defaultRedactedParams are query parameters that carry credentials and are
+// never written to the access log.
+var defaultRedactedParams = []string{"token", "access_token", "refresh_token", "api_key", "key"}
+
+// accessLogFields collects what handlers further down learn about a request,
+// like the authenticated user, for the access log line written after it.
+type accessLogFields struct {
+	user string
+}
+
+func setAccessLogUser(ctx context.Context, email string) {
+	if fields, ok := ctx.Value(accessLogCtx).(*accessLogFields); ok {
+		fields.user = email
+	}
+}
+
+// accessLog writes one structured line per request. Requests that fail with
+// a server error are always logged, others only with the configured sample
+// rate.
+func (app *application) accessLog(next http.Handler) http.Handler {
+	redact := make(map[string]bool)
+	for _, param := range app.config.accessLog.redactParams {
+		redact[strings.ToLower(param)] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		fields := &accessLogFields{}
+		start := time.Now()
+
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), accessLogCtx, fields)))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		if status < http.StatusInternalServerError && rand.Float64() >= app.config.accessLog.sampleRate {
+			return
+		}
+
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		logger := app.loggerFrom(r.Context())
+		log := logger.Infow
+		if status >= http.StatusInternalServerError {
+			log = logger.Errorw
+		}
+
+		log("request",
+			"method", r.Method,
+			"route", route,
+			"path", r.URL.Path,
+			"query", redactQuery(r.URL.Query(), redact),
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"latency", time.Since(start),
+			"user", fields.user,
+			"client_ip", clientIP(r.RemoteAddr),
+			"authorization", redactAuthorization(r.Header.Get("Authorization")),
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
+
+// redactQuery encodes query with the values of the parameters in redact
+// replaced.
+func redactQuery(query url.Values, redact map[string]bool) string {
+	for key, values := range query {
+		if !redact[strings.ToLower(key)] {
+			continue
+		}
+		for i := range values {
+			values[i] = redacted
+		}
+	}
+
+	return query.Encode()
+}
+
+// redactAuthorization keeps the scheme of an Authorization header, so the
+// log shows how a request authenticated, and drops the credentials.
+func redactAuthorization(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	scheme, _, _ := strings.Cut(header, " ")
+	return scheme + " " + redacted
+}
+
+func clientIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newAccessLogRouter(sampleRate float64) (http.Handler, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.InfoLevel)
+
+	app := &application{logger: zap.New(core).Sugar()}
+	app.config.accessLog = accessLogConfig{sampleRate: sampleRate, redactParams: defaultRedactedParams}
+
+	r := chi.NewRouter()
+	r.Use(app.accessLog)
+	r.Get("/links/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		setAccessLogUser(r.Context(), "alice@example.com")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short"))
+	})
+	r.Get("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	return r, logs
+}
+
+func TestAccessLog(t *testing.T) {
+	router, logs := newAccessLogRouter(1)
+
+	req := httptest.NewRequest(http.MethodGet, "/links/abc?token=secret&q=docs", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.RemoteAddr = "203.0.113.7:5555"
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d log entries, want 1", len(entries))
+	}
+
+	fields := entries[0].ContextMap()
+	want := map[string]any{
+		"method":        "GET",
+		"route":         "/links/{slug}",
+		"path":          "/links/abc",
+		"query":         "q=docs&token=%5BREDACTED%5D",
+		"status":        int64(http.StatusTeapot),
+		"bytes":         int64(len("short")),
+		"user":          "alice@example.com",
+		"client_ip":     "203.0.113.7",
+		"authorization": "Bearer [REDACTED]",
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("%s = %v (%T), want %v", key, fields[key], fields[key], value)
+		}
+	}
+
+	for key, value := range fields {
+		if s, ok := value.(string); ok && strings.Contains(s, "secret") {
+			t.Errorf("%s leaks a credential: %q", key, s)
+		}
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	router, logs := newAccessLogRouter(0)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/links/abc", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d log entries, want only the failed request", len(entries))
+	}
+	if entries[0].Level != zapcore.ErrorLevel {
+		t.Errorf("failed request logged at %s, want error", entries[0].Level)
+	}
+}
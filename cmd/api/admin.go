@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/devaartana/e01-oprec-rpl/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// bootstrapAdmins grants the admin role to the accounts listed in
+// AUTH_ADMINS that already exist. Emails that are not registered yet are
+// skipped rather than reserved, otherwise whoever registers one first would
+// become admin. Register the account and restart to promote it.
+func (app *application) bootstrapAdmins(ctx context.Context) error {
+	for _, email := range app.config.auth.admins {
+		err := app.store.Users.SetRole(ctx, email, store.RoleAdmin)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (app *application) AdminGetAllUsersHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := app.store.Users.GetAllUsers(r.Context())
+	if err != nil {
+		app.internalError(w, r, err)
+		return
+	}
+
+	app.writeData(w, r, http.StatusOK, newUserResponses(users))
+}
+
+type SetRolePayload struct {
+	Role string `json:"role" validate:"required,oneof=user admin"`
+}
+
+func (app *application) AdminSetRoleHandler(w http.ResponseWriter, r *http.Request) {
+	email := chi.URLParam(r, "email")
+
+	var payload SetRolePayload
+	if !app.readJSON(w, r, &payload) {
+		return
+	}
+
+	if errs := app.validator.Struct(&payload); len(errs) > 0 {
+		app.failedValidation(w, r, errs)
+		return
+	}
+
+	admin := r.Context().Value(userCtx).(*store.User)
+	if email == admin.Email {
+		writeError(w, r, http.StatusBadRequest, codeAdminSelfAction, "admins cannot change their own role")
+		return
+	}
+
+	if err := app.store.Users.SetRole(r.Context(), email, payload.Role); err != nil {
+		app.storeError(w, r, err)
+		return
+	}
+
+	app.loggerFrom(r.Context()).Infow("user role changed", "email", email, "role", payload.Role, "admin", admin.Email)
+
+	app.writeMessage(w, r, http.StatusOK, "Role is updated")
+}
+
+func (app *application) AdminSuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.setSuspended(w, r, true)
+}
+
+func (app *application) AdminUnsuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.setSuspended(w, r, false)
+}
+
+func (app *application) setSuspended(w http.ResponseWriter, r *http.Request, suspended bool) {
+	email := chi.URLParam(r, "email")
+
+	admin := r.Context().Value(userCtx).(*store.User)
+	if email == admin.Email {
+		writeError(w, r, http.StatusBadRequest, codeAdminSelfAction, "admins cannot suspend their own account")
+		return
+	}
+
+	if err := app.store.Users.SetSuspended(r.Context(), email, suspended); err != nil {
+		app.storeError(w, r, err)
+		return
+	}
+
+	app.loggerFrom(r.Context()).Infow("user suspension changed", "email", email, "suspended", suspended, "admin", admin.Email)
+
+	if suspended {
+		app.writeMessage(w, r, http.StatusOK, "User is suspended")
+	} else {
+		app.writeMessage(w, r, http.StatusOK, "User is unsuspended")
+	}
+}
+
+func (app *application) AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	email := chi.URLParam(r, "email")
+
+	admin := r.Context().Value(userCtx).(*store.User)
+	if email == admin.Email {
+		writeError(w, r, http.StatusBadRequest, codeAdminSelfAction, "admins cannot delete their own account")
+		return
+	}
+
+	if err := app.store.Users.DeleteByEmail(r.Context(), email); err != nil {
+		app.storeError(w, r, err)
+		return
+	}
+
+	app.loggerFrom(r.Context()).Infow("user deleted by admin", "email", email, "admin", admin.Email)
+
+	app.writeMessage(w, r, http.StatusOK, "User is deleted")
+}
+
+func (app *application) AdminGetAllLinksHandler(w http.ResponseWriter, r *http.Request) {
+	links, err := app.store.Links.GetAllLinks(r.Context())
+	if err != nil {
+		app.internalError(w, r, err)
+		return
+	}
+
+	now := time.Now()
+
+	response := make([]AdminLinkResponse, len(links))
+	for i := range links {
+		response[i] = AdminLinkResponse{app.newLinkResponse(&links[i], now), links[i].Owner}
+	}
+
+	app.writeData(w, r, http.StatusOK, response)
+}
+
+func (app *application) AdminDeleteLinkHandler(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+
+	link, err := app.store.Links.GetBySlug(r.Context(), slug)
+	if err != nil {
+		app.storeError(w, r, err)
+		return
+	}
+
+	if err := app.store.Links.DeleteBySlug(r.Context(), link.Owner, slug); err != nil {
+		app.storeError(w, r, err)
+		return
+	}
+
+	admin := r.Context().Value(userCtx).(*store.User)
+	app.loggerFrom(r.Context()).Infow("link deleted by admin", "slug", slug, "owner", link.Owner, "admin", admin.Email)
+
+	app.writeMessage(w, r, http.StatusOK, "Link is deleted")
+}
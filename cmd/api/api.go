@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/devaartana/e01-oprec-rpl/internal/auth"
+	"github.com/devaartana/e01-oprec-rpl/internal/clicks"
+	"github.com/devaartana/e01-oprec-rpl/internal/slug"
 	"github.com/devaartana/e01-oprec-rpl/internal/store"
+	"github.com/devaartana/e01-oprec-rpl/internal/urlcheck"
+	"github.com/devaartana/e01-oprec-rpl/internal/validate"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"go.uber.org/zap"
@@ -18,26 +26,75 @@ type application struct {
 	store         store.Storage
 	logger        *zap.SugaredLogger
 	authenticator auth.Authenticator
+	slugs         *slug.Generator
+	slugPolicy    *slug.Policy
+	urls          *urlcheck.Normalizer
+	clicks        *clicks.Recorder
+	validator     *validate.Validator
+	metrics       *metrics
+
+	// ready is set once startup has finished, see ReadyzHandler.
+	ready atomic.Bool
 }
 
 type config struct {
-	addr    string
-	db      dbConfig
-	auth    authConfig
+	addr            string
+	shutdownTimeout time.Duration
+	db              dbConfig
+	auth            authConfig
+	link            linkConfig
+	click           clickConfig
+	tracing         tracingConfig
+	accessLog       accessLogConfig
 }
 
 type dbConfig struct {
+	driver            string
 	addr              string
 	maxOpenConnection int
 	maxIdleConnection int
 	maxIdleTime       string
 }
 
+type linkConfig struct {
+	baseURL       string
+	slugLength    int
+	slugAlphabet  string
+	slugMinLength int
+	slugMaxLength int
+	reservedSlugs []string
+	redirectType  int
+	defaultExpiry time.Duration
+	maxExpiry     time.Duration
+}
+
+type clickConfig struct {
+	ipSalt        string
+	bufferSize    int
+	batchSize     int
+	flushInterval time.Duration
+}
+
+type accessLogConfig struct {
+	sampleRate   float64
+	redactParams []string
+}
+
+type tracingConfig struct {
+	exporter    string
+	serviceName string
+	sampleRatio float64
+}
+
 type authConfig struct {
-	user   string
-	secret string
-	exp    time.Duration
-	iss    string
+	user       string
+	secret     string
+	exp        time.Duration
+	refreshExp time.Duration
+	iss        string
+	keys       []string
+	activeKey  string
+	admins     []string
 }
 
 func (app *application) mount() http.Handler {
@@ -46,22 +103,66 @@ func (app *application) mount() http.Handler {
 	// Middleware global
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
-
-	r.HandleFunc("/{slug}", app.SlugHandler)
+	r.Use(traceRequests)
+	r.Use(app.metrics.middleware)
+	r.Use(app.accessLog)
+
+	r.NotFound(app.notFound)
+	r.MethodNotAllowed(app.methodNotAllowed)
+
+	// Probes are registered next to the redirect so a slug can never shadow
+	// them, their names are reserved as slugs as well.
+	r.Get("/healthz", app.HealthzHandler)
+	r.Get("/livez", app.HealthzHandler)
+	r.Get("/readyz", app.ReadyzHandler)
+	r.Method(http.MethodGet, "/metrics", app.metrics.handler())
+
+	r.Get("/.well-known/jwks.json", app.JWKSHandler)
+	r.Get("/{slug}", app.SlugHandler)
+	r.Head("/{slug}", app.SlugHandler)
 	r.Route("/api", func(r chi.Router) {
+		r.Get("/openapi.json", app.OpenAPIHandler)
+		r.Get("/docs", app.DocsHandler)
+		r.Get("/docs/{file}", app.DocsAssetHandler)
+
 		r.Post("/register", app.RegisterUserHandler)
 		r.Post("/login", app.LoginUserHandler)
-		r.Get("/user", app.UserHandler)
+		r.Post("/token/refresh", app.RefreshTokenHandler)
+		r.With(app.AuthTokenMiddleware, RequireSession).Post("/logout", app.LogoutHandler)
+		r.With(app.AuthTokenMiddleware).Get("/user", app.UserHandler)
 
 		r.Route("/links", func(r chi.Router) {
 			r.Use(app.AuthTokenMiddleware)
 
-			r.Post("/", app.CreateLinkHandler)
-			r.Get("/", app.GetAllLinksHandler)
-			r.Put("/", app.UpdateLinkHandler)
-			r.Delete("/{slug}", app.DeleteLinkHandler)
-			r.Get("/refresh/{slug}", app.RefreshExpiredDateHandler)
+			r.With(RequireScope(scopeLinksWrite)).Post("/", app.CreateLinkHandler)
+			r.With(RequireScope(scopeLinksRead)).Get("/", app.GetAllLinksHandler)
+			r.With(RequireScope(scopeLinksWrite)).Put("/", app.UpdateLinkHandler)
+			r.With(RequireScope(scopeLinksWrite)).Delete("/{slug}", app.DeleteLinkHandler)
+			r.With(RequireScope(scopeLinksWrite)).Get("/refresh/{slug}", app.RefreshExpiredDateHandler)
+			r.With(RequireScope(scopeLinksRead)).Get("/{slug}/stats", app.LinkStatsHandler)
+		})
+
+		r.Route("/keys", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(RequireSession)
+
+			r.Post("/", app.CreateAPIKeyHandler)
+			r.Get("/", app.GetAllAPIKeysHandler)
+			r.Delete("/{id}", app.RevokeAPIKeyHandler)
+		})
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(RequireSession)
+			r.Use(RequireRole(store.RoleAdmin))
+
+			r.Get("/users", app.AdminGetAllUsersHandler)
+			r.Put("/users/{email}/role", app.AdminSetRoleHandler)
+			r.Post("/users/{email}/suspend", app.AdminSuspendUserHandler)
+			r.Post("/users/{email}/unsuspend", app.AdminUnsuspendUserHandler)
+			r.Delete("/users/{email}", app.AdminDeleteUserHandler)
+			r.Get("/links", app.AdminGetAllLinksHandler)
+			r.Delete("/links/{slug}", app.AdminDeleteLinkHandler)
 		})
 
 	})
@@ -69,7 +170,27 @@ func (app *application) mount() http.Handler {
 	return r
 }
 
-func (app *application) run(mux http.Handler) error {
+// shutdownDeadline is the deadline shared by every step of the shutdown. It
+// starts the first time the shutdown asks for its context.
+type shutdownDeadline struct {
+	timeout time.Duration
+	once    sync.Once
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func (d *shutdownDeadline) context() context.Context {
+	d.once.Do(func() {
+		d.ctx, d.cancel = context.WithTimeout(context.Background(), d.timeout)
+	})
+	return d.ctx
+}
+
+// run serves mux until ctx is done, then stops accepting connections and
+// waits for in-flight requests to finish within deadline. The deadline is
+// shared with the caller, which closes the remaining resources in the time
+// the drain leaves over.
+func (app *application) run(ctx context.Context, mux http.Handler, deadline *shutdownDeadline) error {
 
 	srv := &http.Server{
 		Addr:         app.config.addr,
@@ -79,10 +200,29 @@ func (app *application) run(mux http.Handler) error {
 		IdleTimeout:  time.Minute,
 	}
 
-	app.logger.Infow("server has started", "addr", app.config.addr)
+	serveErr := make(chan error, 1)
+	go func() {
+		app.logger.Infow("server has started", "addr", app.config.addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Readiness probes that are still being served report the service as
+	// going away.
+	app.ready.Store(false)
+	app.logger.Infow("shutting down server", "addr", app.config.addr, "timeout", app.config.shutdownTimeout)
+
+	if err := srv.Shutdown(deadline.context()); err != nil {
+		srv.Close()
+		return fmt.Errorf("requests did not drain in time: %w", err)
+	}
 
-	err := srv.ListenAndServe()
-	if !errors.Is(err, http.ErrServerClosed) {
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type openAPIDocument struct {
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+func loadOpenAPI(t *testing.T) openAPIDocument {
+	t.Helper()
+
+	var doc openAPIDocument
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+
+	return doc
+}
+
+// mountedRoutes returns the routes registered in mount as "METHOD /path",
+// without the trailing slash chi keeps for routes mounted at "/".
+func mountedRoutes(t *testing.T) map[string]bool {
+	t.Helper()
+
+	app := &application{metrics: newMetrics()}
+	router, ok := app.mount().(chi.Routes)
+	if !ok {
+		t.Fatal("mount does not return a chi router")
+	}
+
+	routes := map[string]bool{}
+	err := chi.Walk(router, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if len(route) > 1 {
+			route = strings.TrimSuffix(route, "/")
+		}
+		routes[method+" "+route] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return routes
+}
+
+func TestRoutesDocumented(t *testing.T) {
+	doc := loadOpenAPI(t)
+
+	documented := map[string]bool{}
+	for path, operations := range doc.Paths {
+		for method := range operations {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	mounted := mountedRoutes(t)
+
+	for route := range mounted {
+		if !documented[route] {
+			t.Errorf("%s is mounted but missing from openapi.json", route)
+		}
+	}
+
+	for route := range documented {
+		if !mounted[route] {
+			t.Errorf("%s is documented in openapi.json but not mounted", route)
+		}
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	app := &application{metrics: newMetrics()}
+	handler := app.mount()
+
+	tests := []struct {
+		path        string
+		contentType string
+	}{
+		{"/api/openapi.json", "application/json"},
+		{"/api/docs", "text/html; charset=utf-8"},
+		{"/api/docs/swagger-ui.css", "text/css; charset=utf-8"},
+		{"/api/docs/swagger-ui-bundle.js", "text/javascript; charset=utf-8"},
+		{"/api/docs/swagger-initializer.js", "text/javascript; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s: status = %d, want %d", tt.path, rec.Code, http.StatusOK)
+		}
+		if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("GET %s: Content-Type = %q, want %q", tt.path, got, tt.contentType)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/devaartana/e01-oprec-rpl/internal/auth"
+	"github.com/devaartana/e01-oprec-rpl/internal/env"
+	"github.com/devaartana/e01-oprec-rpl/internal/store"
+	"github.com/devaartana/e01-oprec-rpl/internal/validate"
+	"github.com/go-chi/chi/v5"
+)
+
+type CreateAPIKeyPayload struct {
+	Name      string     `json:"name" validate:"required,max=64"`
+	Scopes    []string   `json:"scopes" validate:"oneof=links:read links:write"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	ExpiresIn string     `json:"expires_in"`
+}
+
+// CreateAPIKeyResponse is the only place the plain text key is ever shown.
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+func (app *application) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateAPIKeyPayload
+
+	if !app.readJSON(w, r, &payload) {
+		return
+	}
+
+	errs := app.validator.Struct(&payload)
+
+	now := time.Now()
+
+	var expiry time.Time
+	switch {
+	case payload.ExpiresAt != nil && payload.ExpiresIn != "":
+		errs = append(errs, validate.FieldError{Field: "expiry", Code: "expiry_conflict", Message: "only one of expires_at and expires_in may be set"})
+	case payload.ExpiresAt != nil:
+		expiry = *payload.ExpiresAt
+	case payload.ExpiresIn != "":
+		d, err := env.ParseDuration(payload.ExpiresIn)
+		if err != nil {
+			errs = append(errs, validate.FieldError{Field: "expiry", Code: "expiry_invalid", Message: "expires_in must be a duration like 90m, 72h or 30d"})
+		}
+		expiry = now.Add(d)
+	}
+
+	if !errs.Has("expiry") && !expiry.IsZero() && !expiry.After(now) {
+		errs = append(errs, validate.FieldError{Field: "expiry", Code: "expiry_in_past", Message: "expiry must be in the future"})
+	}
+
+	if len(errs) > 0 {
+		app.failedValidation(w, r, errs)
+		return
+	}
+
+	// Keys without explicit scopes get every scope, like a session token.
+	scopes := payload.Scopes
+	if len(scopes) == 0 {
+		scopes = apiKeyScopes
+	}
+
+	id, err := auth.NewID()
+	if err != nil {
+		app.internalError(w, r, err)
+		return
+	}
+
+	raw, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		app.internalError(w, r, err)
+		return
+	}
+
+	user := r.Context().Value(userCtx).(*store.User)
+
+	key := &store.APIKey{
+		ID:           id,
+		Owner:        user.Email,
+		Name:         payload.Name,
+		Prefix:       prefix,
+		Hash:         auth.HashToken(raw),
+		Scopes:       slices.Compact(slices.Sorted(slices.Values(scopes))),
+		Created_at:   now,
+		Expired_date: expiry,
+	}
+
+	if err := app.store.APIKeys.Create(r.Context(), key); err != nil {
+		app.internalError(w, r, err)
+		return
+	}
+
+	app.writeData(w, r, http.StatusCreated, CreateAPIKeyResponse{newAPIKeyResponse(key, now), raw})
+}
+
+func (app *application) GetAllAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userCtx).(*store.User)
+
+	keys, err := app.store.APIKeys.GetAll(r.Context(), user.Email)
+	if err != nil {
+		app.internalError(w, r, err)
+		return
+	}
+
+	now := time.Now()
+
+	response := make([]APIKeyResponse, len(keys))
+	for i := range keys {
+		response[i] = newAPIKeyResponse(&keys[i], now)
+	}
+
+	app.writeData(w, r, http.StatusOK, response)
+}
+
+func (app *application) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	user := r.Context().Value(userCtx).(*store.User)
+
+	if err := app.store.APIKeys.Revoke(r.Context(), user.Email, id); err != nil {
+		app.storeError(w, r, err)
+		return
+	}
+
+	app.writeMessage(w, r, http.StatusOK, "API key is revoked")
+}
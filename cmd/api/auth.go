@@ -1,31 +1,30 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"time"
 
 	"net/http"
 
+	"github.com/devaartana/e01-oprec-rpl/internal/auth"
 	"github.com/devaartana/e01-oprec-rpl/internal/store"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 type RegisterUserPayload struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"required,min=3,max=32"`
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
 }
 
 func (app *application) RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
 	var payload RegisterUserPayload
 
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Bad request", http.StatusBadRequest)
+	if !app.readJSON(w, r, &payload) {
 		return
 	}
 
-	if length := len(payload.Password); length < 8 {
-		http.Error(w, "Password is not long enough", http.StatusBadRequest)
+	if errs := app.validator.Struct(&payload); len(errs) > 0 {
+		app.failedValidation(w, r, errs)
 		return
 	}
 
@@ -33,84 +32,86 @@ func (app *application) RegisterUserHandler(w http.ResponseWriter, r *http.Reque
 		Username:   payload.Username,
 		Email: 	payload.Email,
 		Created_at: time.Now(),
-		Links: 	[]store.Link{},
+		Role:       store.RoleUser,
 	}
 
-	user.SetPassword(payload.Password)
+	if err := user.SetPassword(payload.Password); err != nil {
+		app.internalError(w, r, err)
+		return
+	}
 
 	if err := app.store.Users.Create(r.Context(), user); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.storeError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	w.Write([]byte("User is registered"))
+	app.writeMessage(w, r, http.StatusCreated, "User is registered")
 }
 
 type LoginUserPayload struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 
 func (app *application) LoginUserHandler(w http.ResponseWriter, r *http.Request) {
 	var payload LoginUserPayload
 
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Bad request", http.StatusBadRequest)
+	if !app.readJSON(w, r, &payload) {
 		return
 	}
 
-	if length := len(payload.Password); length < 8 {
-		http.Error(w, "Password is not long enough", http.StatusBadRequest)
+	if errs := app.validator.Struct(&payload); len(errs) > 0 {
+		app.failedValidation(w, r, errs)
 		return
 	}
 
+	// Unknown emails and wrong passwords get the same response so the login
+	// can't be used to find out which emails are registered.
 	user, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
-	if err != nil {
-		http.Error(w, "Email is not exist", http.StatusInternalServerError)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.internalError(w, r, err)
 		return
 	}
 
-	if user.Compare(payload.Password) != nil {
-		http.Error(w, "Invalid password", http.StatusUnauthorized)
+	if errors.Is(err, store.ErrNotFound) || user.Compare(payload.Password) != nil {
+		writeError(w, r, http.StatusUnauthorized, codeInvalidCredentials, "email or password is incorrect")
 		return
 	}
 
-	claims := jwt.MapClaims{
-		"email": payload.Email,
-		"exp":   time.Now().Add(app.config.auth.exp).Unix(),
-		"iat":   time.Now().Unix(),
-		"nbf":   time.Now().Unix(),
-		"iss":   app.config.auth.iss,
-		"aud":   app.config.auth.iss,
+	if user.Suspended {
+		writeSuspended(w, r)
+		return
 	}
 
-	token, err := app.authenticator.GenerateToken(claims)
+	tokens, err := app.startSession(r.Context(), user.Email)
 	if err != nil {
-		http.Error(w, "Failed to create token", http.StatusInternalServerError)
+		app.internalError(w, r, err)
 		return
 	}
 
-	w.Header().Add("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-
-	if err := json.NewEncoder(w).Encode(map[string]string{"token": token}); err != nil {
-		http.Error(w, "Failed to write response", http.StatusInternalServerError)
-	}
+	app.writeData(w, r, http.StatusOK, tokens)
 }
 
-
+// UserHandler returns the authenticated user. Listing every user is only
+// available to admins, see AdminGetAllUsersHandler.
 func (app *application) UserHandler(w http.ResponseWriter, r *http.Request) {
-	user, err:= app.store.Users.GetAllUsers(r.Context())
-	if err != nil {
-		http.Error(w, "Failed to get user", http.StatusInternalServerError)
+	user := r.Context().Value(userCtx).(*store.User)
+
+	app.writeData(w, r, http.StatusOK, newUserResponse(user))
+}
+
+func (app *application) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.authenticator.(auth.KeySetProvider)
+	if !ok {
+		app.notFound(w, r)
 		return
 	}
 
-	w.Header().Add("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Cache-Control", "public, max-age=300")
 
-	if err := json.NewEncoder(w).Encode(user); err != nil {
-		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+	// Key sets have a standard format that JWT libraries read directly, so
+	// unlike other responses this one is not wrapped in an envelope.
+	if err := writeJSON(w, http.StatusOK, provider.JWKS()); err != nil {
+		app.logger.Errorw("failed to write response", "error", err)
 	}
-}
\ No newline at end of file
+}
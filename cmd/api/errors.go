@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/devaartana/e01-oprec-rpl/internal/store"
+	"github.com/devaartana/e01-oprec-rpl/internal/validate"
+)
+
+// Error codes returned by the API. The codes are part of the API contract,
+// clients match on them instead of on messages. Validation codes reported by
+// the slug and urlcheck packages and by resolveExpiry are listed in the
+// README together with these.
+const (
+	codeBadRequest          = "bad_request"
+	codeUnknownField        = "field_unknown"
+	codeFieldType           = "field_type_invalid"
+	codeBodyTooLarge        = "body_too_large"
+	codeValidationFailed    = "validation_failed"
+	codeUnauthorized        = "unauthorized"
+	codeInvalidCredentials  = "invalid_credentials"
+	codeAccountSuspended    = "account_suspended"
+	codeSessionRequired     = "session_required"
+	codeInsufficientScope   = "insufficient_scope"
+	codeForbidden           = "forbidden"
+	codeNotFound            = "not_found"
+	codeMethodNotAllowed    = "method_not_allowed"
+	codeLinkExpired         = "link_expired"
+	codeLinkIsAlias         = "link_is_alias"
+	codeEmailTaken          = "email_taken"
+	codeUsernameTaken       = "username_taken"
+	codeSlugTaken           = "slug_taken"
+	codeRedirectTypeInvalid = "redirect_type_invalid"
+	codeAdminSelfAction     = "admin_self_action"
+	codeQueryInvalid        = "query_invalid"
+	codeInternal            = "internal_error"
+)
+
+func (app *application) badRequest(w http.ResponseWriter, r *http.Request, message string) {
+	writeError(w, r, http.StatusBadRequest, codeBadRequest, message)
+}
+
+func (app *application) unauthorized(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "authentication is required")
+}
+
+func (app *application) notFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+}
+
+func (app *application) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, r.Method+" is not allowed on this resource")
+}
+
+func (app *application) linkExpired(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusGone, codeLinkExpired, "link is expired")
+}
+
+func (app *application) linkIsAlias(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusConflict, codeLinkIsAlias, "link is an alias, update the link it points to instead")
+}
+
+// internalError logs err and hides it from the client behind a generic 500
+// response.
+func (app *application) internalError(w http.ResponseWriter, r *http.Request, err error) {
+	app.loggerFrom(r.Context()).Errorw("internal error",
+		"method", r.Method,
+		"path", r.URL.Path,
+		"error", err,
+	)
+
+	writeError(w, r, http.StatusInternalServerError, codeInternal, "the server encountered a problem and could not process the request")
+}
+
+// storeError maps the sentinel errors of the store package to responses.
+// Unknown errors become a 500 response.
+func (app *application) storeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		app.notFound(w, r)
+	case errors.Is(err, store.ErrDuplicateEmail):
+		writeError(w, r, http.StatusConflict, codeEmailTaken, "email is already registered", validate.FieldError{Field: "email", Code: codeEmailTaken, Message: "email is already registered"})
+	case errors.Is(err, store.ErrDuplicateUsername):
+		writeError(w, r, http.StatusConflict, codeUsernameTaken, "username is already taken", validate.FieldError{Field: "username", Code: codeUsernameTaken, Message: "username is already taken"})
+	case errors.Is(err, store.ErrDuplicateSlug):
+		writeError(w, r, http.StatusConflict, codeSlugTaken, "slug is already taken", validate.FieldError{Field: "slug", Code: codeSlugTaken, Message: "slug is already taken"})
+	default:
+		app.internalError(w, r, err)
+	}
+}
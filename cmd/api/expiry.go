@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/devaartana/e01-oprec-rpl/internal/env"
+	"github.com/devaartana/e01-oprec-rpl/internal/validate"
+)
+
+// ExpiryPayload lets clients choose when a link expires. At most one of the
+// fields may be set; when none is set the caller decides the default.
+type ExpiryPayload struct {
+	ExpiresAt    *time.Time `json:"expires_at"`
+	ExpiresIn    string     `json:"expires_in"`
+	NeverExpires bool       `json:"never_expires"`
+}
+
+func (p ExpiryPayload) empty() bool {
+	return p.ExpiresAt == nil && p.ExpiresIn == "" && !p.NeverExpires
+}
+
+type expiryError struct {
+	code    string
+	message string
+}
+
+func (e *expiryError) Error() string {
+	return e.message
+}
+
+// expiryFromQuery reads an ExpiryPayload from the expires_at, expires_in and
+// never_expires query parameters.
+func expiryFromQuery(r *http.Request) (ExpiryPayload, error) {
+	query := r.URL.Query()
+
+	payload := ExpiryPayload{ExpiresIn: query.Get("expires_in")}
+
+	if raw := query.Get("expires_at"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return payload, &expiryError{"expiry_invalid", "expires_at must be an RFC 3339 timestamp"}
+		}
+		payload.ExpiresAt = &t
+	}
+
+	if raw := query.Get("never_expires"); raw != "" {
+		never, err := strconv.ParseBool(raw)
+		if err != nil {
+			return payload, &expiryError{"expiry_invalid", "never_expires must be true or false"}
+		}
+		payload.NeverExpires = never
+	}
+
+	return payload, nil
+}
+
+// resolveExpiry turns p into an expiry date, falling back to the configured
+// default when p is empty. The zero time means the link never expires.
+func (app *application) resolveExpiry(p ExpiryPayload, now time.Time) (time.Time, error) {
+	set := 0
+	if p.ExpiresAt != nil {
+		set++
+	}
+	if p.ExpiresIn != "" {
+		set++
+	}
+	if p.NeverExpires {
+		set++
+	}
+
+	if set > 1 {
+		return time.Time{}, &expiryError{"expiry_conflict", "only one of expires_at, expires_in and never_expires may be set"}
+	}
+
+	max := app.config.link.maxExpiry
+
+	var expiry time.Time
+	switch {
+	case p.NeverExpires:
+		if max > 0 {
+			return time.Time{}, &expiryError{"expiry_never_not_allowed", fmt.Sprintf("links must expire within %s", max)}
+		}
+		return time.Time{}, nil
+	case p.ExpiresAt != nil:
+		expiry = *p.ExpiresAt
+	case p.ExpiresIn != "":
+		d, err := env.ParseDuration(p.ExpiresIn)
+		if err != nil {
+			return time.Time{}, &expiryError{"expiry_invalid", "expires_in must be a duration like 90m, 72h or 30d"}
+		}
+		expiry = now.Add(d)
+	default:
+		if app.config.link.defaultExpiry == 0 {
+			return time.Time{}, nil
+		}
+		expiry = now.Add(app.config.link.defaultExpiry)
+	}
+
+	if !expiry.After(now) {
+		return time.Time{}, &expiryError{"expiry_in_past", "expiry must be in the future"}
+	}
+
+	if max > 0 && expiry.Sub(now) > max {
+		return time.Time{}, &expiryError{"expiry_too_long", fmt.Sprintf("links must expire within %s", max)}
+	}
+
+	return expiry, nil
+}
+
+// expiryFieldError reports errors returned by resolveExpiry and
+// expiryFromQuery as an error of the expiry field.
+func expiryFieldError(err error) (validate.FieldError, bool) {
+	if e, ok := err.(*expiryError); ok {
+		return validate.FieldError{Field: "expiry", Code: e.code, Message: e.message}, true
+	}
+
+	return validate.FieldError{}, false
+}
+
+// writeExpiryError writes a 422 response for errors returned by
+// resolveExpiry and expiryFromQuery.
+func (app *application) writeExpiryError(w http.ResponseWriter, r *http.Request, err error) {
+	if fieldErr, ok := expiryFieldError(err); ok {
+		app.failedValidation(w, r, validate.Errors{fieldErr})
+		return
+	}
+
+	app.internalError(w, r, err)
+}
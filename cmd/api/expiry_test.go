@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveExpiresIn(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	app := &application{}
+	app.config.link = linkConfig{defaultExpiry: 30 * 24 * time.Hour}
+
+	limited := &application{}
+	limited.config.link = linkConfig{maxExpiry: 30 * 24 * time.Hour}
+
+	tests := []struct {
+		app       *application
+		expiresIn string
+		want      time.Time
+		code      string
+	}{
+		{app: app, expiresIn: "", want: now.Add(30 * 24 * time.Hour)},
+		{app: app, expiresIn: "90m", want: now.Add(90 * time.Minute)},
+		{app: app, expiresIn: "30d", want: now.Add(30 * 24 * time.Hour)},
+		{app: app, expiresIn: "106751d", want: now.Add(106751 * 24 * time.Hour)},
+		{app: app, expiresIn: "106752d", code: "expiry_invalid"},
+		{app: app, expiresIn: "9223372036854775807d", code: "expiry_invalid"},
+		{app: app, expiresIn: "99999999999999999999d", code: "expiry_invalid"},
+		{app: app, expiresIn: "-1d", code: "expiry_in_past"},
+		{app: app, expiresIn: "-106751d", code: "expiry_in_past"},
+		{app: app, expiresIn: "-106752d", code: "expiry_invalid"},
+		{app: app, expiresIn: "d", code: "expiry_invalid"},
+		{app: app, expiresIn: "1.5d", code: "expiry_invalid"},
+		{app: limited, expiresIn: "30d", want: now.Add(30 * 24 * time.Hour)},
+		{app: limited, expiresIn: "31d", code: "expiry_too_long"},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.app.resolveExpiry(ExpiryPayload{ExpiresIn: tt.expiresIn}, now)
+
+		if tt.code != "" {
+			fieldErr, ok := expiryFieldError(err)
+			if !ok || fieldErr.Code != tt.code {
+				t.Errorf("expires_in %q: got error %v, want %s", tt.expiresIn, err, tt.code)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("expires_in %q: %v", tt.expiresIn, err)
+		} else if !got.Equal(tt.want) {
+			t.Errorf("expires_in %q: got %v, want %v", tt.expiresIn, got, tt.want)
+		}
+	}
+}
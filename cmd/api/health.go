@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// readyTimeout bounds how long ReadyzHandler waits for the database.
+const readyTimeout = 2 * time.Second
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+type componentStatus struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type healthResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]componentStatus `json:"components,omitempty"`
+}
+
+// HealthzHandler reports that the process is alive and serving requests. It
+// checks nothing else, so a database outage doesn't get the process killed.
+func (app *application) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeHealth(w, http.StatusOK, healthResponse{Status: statusOK})
+}
+
+// ReadyzHandler reports whether the service can handle traffic: startup has
+// finished, the database answers a ping within readyTimeout and the click
+// recorder is running.
+func (app *application) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	components := map[string]componentStatus{
+		"config":   app.checkConfig(),
+		"database": app.checkDatabase(r.Context()),
+		"clicks":   app.checkClicks(),
+	}
+
+	response := healthResponse{Status: statusOK, Components: components}
+	status := http.StatusOK
+
+	for _, component := range components {
+		if component.Status != statusOK {
+			response.Status = statusUnavailable
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	app.writeHealth(w, status, response)
+}
+
+func (app *application) checkConfig() componentStatus {
+	if !app.ready.Load() {
+		return componentStatus{Status: statusUnavailable, Error: "startup has not finished"}
+	}
+	return componentStatus{Status: statusOK}
+}
+
+func (app *application) checkDatabase(ctx context.Context) componentStatus {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := app.store.Health.Ping(ctx)
+	latency := time.Since(start).String()
+
+	if err != nil {
+		app.loggerFrom(ctx).Warnw("database ping failed", "error", err)
+		return componentStatus{Status: statusUnavailable, Latency: latency, Error: "database is unreachable"}
+	}
+
+	return componentStatus{Status: statusOK, Latency: latency}
+}
+
+func (app *application) checkClicks() componentStatus {
+	if !app.clicks.Running() {
+		return componentStatus{Status: statusUnavailable, Error: "click recorder is not running"}
+	}
+	return componentStatus{Status: statusOK}
+}
+
+func (app *application) writeHealth(w http.ResponseWriter, status int, response healthResponse) {
+	// Probes are read by the orchestrator rather than API clients, so like the
+	// JWKS these responses are not wrapped in an envelope.
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := writeJSON(w, status, response); err != nil {
+		app.logger.Errorw("failed to write response", "error", err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/devaartana/e01-oprec-rpl/internal/validate"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func writeJSON(w http.ResponseWriter, status int, data any) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	return json.NewEncoder(w).Encode(data)
+}
+
+// envelope is the body of every API response. Successful responses have the
+// code "ok" and carry data or a message, failed responses carry an error code
+// from the catalog in errors.go and optionally details about the failure.
+type envelope struct {
+	Code      string          `json:"code"`
+	Message   string          `json:"message,omitempty"`
+	Data      any             `json:"data,omitempty"`
+	Details   validate.Errors `json:"details,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+}
+
+const codeOK = "ok"
+
+func (app *application) writeData(w http.ResponseWriter, r *http.Request, status int, data any) {
+	app.writeEnvelope(w, status, envelope{
+		Code:      codeOK,
+		Data:      data,
+		RequestID: middleware.GetReqID(r.Context()),
+	})
+}
+
+func (app *application) writeMessage(w http.ResponseWriter, r *http.Request, status int, message string) {
+	app.writeEnvelope(w, status, envelope{
+		Code:      codeOK,
+		Message:   message,
+		RequestID: middleware.GetReqID(r.Context()),
+	})
+}
+
+func (app *application) writeEnvelope(w http.ResponseWriter, status int, body envelope) {
+	if err := writeJSON(w, status, body); err != nil {
+		app.logger.Errorw("failed to write response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string, details ...validate.FieldError) {
+	// The response can't be changed anymore once writing it failed, and the
+	// caller has nothing left to do but return.
+	_ = writeJSON(w, status, envelope{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: middleware.GetReqID(r.Context()),
+	})
+}
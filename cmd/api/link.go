@@ -1,88 +1,283 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	// "strings"
 	"time"
 
 	"github.com/devaartana/e01-oprec-rpl/internal/store"
+	"github.com/devaartana/e01-oprec-rpl/internal/validate"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 )
 
 func (app *application) SlugHandler(w http.ResponseWriter, r *http.Request) {
 
 	slug := chi.URLParam(r, "slug")
 
-	app.logger.Infow("slug", "slug", slug)
+	app.loggerFrom(r.Context()).Infow("slug", "slug", slug)
 	link, err := app.store.Links.GetBySlug(r.Context(), slug)
+
+	// Aliases left behind by a rename redirect wherever their link points now.
+	if err == nil && link.AliasOf != "" {
+		link, err = app.store.Links.GetBySlug(r.Context(), link.AliasOf)
+	}
+
 	if err != nil {
-		if err == store.ErrNotFound {	
-			http.Error(w, "Not Found", http.StatusNotFound)
-			return
+		if errors.Is(err, store.ErrNotFound) {
+			app.metrics.redirect(redirectMiss)
 		}
-
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return 
+		app.storeError(w, r, err)
+		return
 	}
 
-	if link.Expired_date.Before(time.Now()) {
-		http.Error(w, "Link is expired", http.StatusGone)
+	if link.IsExpired(time.Now()) {
+		app.metrics.redirect(redirectExpired)
+		app.linkExpired(w, r)
 		return
 	}
 
-	http.Redirect(w, r, link.OriginalUrl, http.StatusMovedPermanently)
+	app.metrics.redirect(redirectHit)
+
+	// HEAD requests come from link previews and uptime checks, not visitors.
+	if r.Method != http.MethodHead {
+		app.clicks.Record(store.Click{
+			Slug:      link.Slug,
+			Owner:     link.Owner,
+			Timestamp: time.Now(),
+			Referrer:  r.Referer(),
+			UserAgent: r.UserAgent(),
+			IPHash:    app.hashIP(r.RemoteAddr),
+			RequestID: middleware.GetReqID(r.Context()),
+		})
+	}
+
+	w.Header().Set("Cache-Control", cacheControl(link, time.Now()))
+	http.Redirect(w, r, link.OriginalUrl, link.RedirectStatus())
+}
+
+// maxRedirectAge caps how long browsers may cache a permanent redirect.
+const maxRedirectAge = 365 * 24 * time.Hour
+
+// cacheControl lets browsers cache permanent redirects until the link
+// expires and keeps temporary redirects out of caches altogether.
+func cacheControl(link *store.Link, now time.Time) string {
+	status := link.RedirectStatus()
+	if status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+		return "private, no-store"
+	}
+
+	age := link.Expired_date.Sub(now)
+	if link.Expired_date.IsZero() || age > maxRedirectAge {
+		age = maxRedirectAge
+	}
+
+	return fmt.Sprintf("public, max-age=%d", int(age.Seconds()))
 }
 
 type CreateLinkPayload struct {
-	Slug        string `json:"slug"`
-	OriginalUrl string `json:"original_url"`
+	Slug         string `json:"slug" validate:"slug"`
+	OriginalUrl  string `json:"original_url" validate:"required,url"`
+	RedirectType int    `json:"redirect_type" validate:"redirect_type"`
+	ExpiryPayload
 }
 
+// maxSlugAttempts bounds how often CreateLinkHandler retries when a generated
+// slug is already taken.
+const maxSlugAttempts = 5
+
 func (app *application) CreateLinkHandler(w http.ResponseWriter, r *http.Request) {
 	var payload CreateLinkPayload
 
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Bad request", http.StatusBadRequest)
+	if !app.readJSON(w, r, &payload) {
+		return
+	}
+
+	if payload.RedirectType == 0 {
+		payload.RedirectType = app.config.link.redirectType
+	}
+
+	errs := app.validator.Struct(&payload)
+
+	now := time.Now()
+
+	expiry, err := app.resolveExpiry(payload.ExpiryPayload, now)
+	if err != nil {
+		fieldErr, ok := expiryFieldError(err)
+		if !ok {
+			app.internalError(w, r, err)
+			return
+		}
+		errs = append(errs, fieldErr)
+	}
+
+	if len(errs) > 0 {
+		app.failedValidation(w, r, errs)
+		return
+	}
+
+	originalUrl, err := app.urls.Normalize(payload.OriginalUrl)
+	if err != nil {
+		app.internalError(w, r, err)
 		return
 	}
 
 	link := &store.Link{
 		Slug:         payload.Slug,
-		OriginalUrl:  payload.OriginalUrl,
-		Created_at:   time.Now(),
-		Expired_date: time.Now().Add(time.Hour * 24 * 30),
+		OriginalUrl:  originalUrl,
+		Created_at:   now,
+		Expired_date: expiry,
+		RedirectType: payload.RedirectType,
 	}
 
 	user := r.Context().Value(userCtx).(*store.User)
 
-	if err := app.store.Links.Create(r.Context(), user.Email, link); err != nil {
-		if err == store.ErrDuplicateSlug {
-			http.Error(w, "Slug is already exist", http.StatusBadRequest)
-			return
-		}
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	if err := app.createLink(r.Context(), user.Email, link, payload.Slug == ""); err != nil {
+		app.storeError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	w.Write([]byte("Link is created"))
+	app.writeData(w, r, http.StatusCreated, app.newLinkResponse(link, now))
+}
+
+// createLink stores link, generating its slug when generate is set. A
+// generated slug that collides with an existing one is replaced and retried.
+func (app *application) createLink(ctx context.Context, email string, link *store.Link, generate bool) error {
+	if !generate {
+		return app.store.Links.Create(ctx, email, link)
+	}
+
+	for attempt := 0; attempt < maxSlugAttempts; attempt++ {
+		generated, err := app.slugs.Generate()
+		if err != nil {
+			return err
+		}
+
+		if app.slugPolicy.Validate(generated) != nil {
+			continue
+		}
+
+		link.Slug = generated
+
+		err = app.store.Links.Create(ctx, email, link)
+		if !errors.Is(err, store.ErrDuplicateSlug) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("no valid free slug after %d attempts", maxSlugAttempts)
 }
 
+const (
+	defaultLinkLimit = store.DefaultLinkLimit
+	maxLinkLimit     = 100
+)
+
 func (app *application) GetAllLinksHandler(w http.ResponseWriter, r *http.Request) {
 	user, ok := r.Context().Value(userCtx).(*store.User)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		app.unauthorized(w, r)
+		return
+	}
+
+	query, errs := linkQueryFromRequest(r)
+	if len(errs) > 0 {
+		writeError(w, r, http.StatusBadRequest, codeQueryInvalid, "one or more query parameters are invalid", errs...)
 		return
 	}
 
-	links, err := app.store.Links.GetAll(r.Context(), user.Email)
+	now := time.Now()
+	query.Now = now
+
+	page, err := app.store.Links.List(r.Context(), user.Email, query)
+	if errors.Is(err, store.ErrInvalidCursor) {
+		writeError(w, r, http.StatusBadRequest, codeQueryInvalid, "cursor is invalid", queryError("cursor", "cursor is invalid or belongs to another sort order"))
+		return
+	}
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		app.internalError(w, r, err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(links)
+	response := LinkPageResponse{
+		Links:      make([]LinkResponse, len(page.Links)),
+		NextCursor: page.NextCursor,
+	}
+	for i := range page.Links {
+		response.Links[i] = app.newLinkResponse(&page.Links[i], now)
+	}
+
+	app.writeData(w, r, http.StatusOK, response)
+}
+
+// linkQueryFromRequest reads the paging, filter and sort query parameters of
+// the link listing and reports every invalid one.
+func linkQueryFromRequest(r *http.Request) (store.LinkQuery, validate.Errors) {
+	values := r.URL.Query()
+
+	var errs validate.Errors
+
+	limit, ok := queryInt(r, "limit", defaultLinkLimit, maxLinkLimit)
+	if !ok {
+		errs = append(errs, queryError("limit", fmt.Sprintf("limit must be between 1 and %d", maxLinkLimit)))
+	}
+
+	query := store.LinkQuery{
+		Limit:  limit,
+		Cursor: values.Get("cursor"),
+		Search: values.Get("q"),
+	}
+
+	switch status := store.LinkStatus(values.Get("status")); status {
+	case store.LinkStatusAll, store.LinkStatusActive, store.LinkStatusExpired:
+		query.Status = status
+	default:
+		errs = append(errs, queryError("status", "status must be active or expired"))
+	}
+
+	switch sort := store.LinkSort(values.Get("sort")); sort {
+	case "", store.LinkSortCreatedAt, store.LinkSortExpiredDate, store.LinkSortClicks:
+		query.Sort = sort
+	default:
+		errs = append(errs, queryError("sort", "sort must be created_at, expired_date or clicks"))
+	}
+
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		errs = append(errs, queryError("order", "order must be asc or desc"))
+	}
+
+	for _, param := range []struct {
+		key string
+		dst *time.Time
+	}{
+		{"created_after", &query.CreatedAfter},
+		{"created_before", &query.CreatedBefore},
+	} {
+		raw := values.Get(param.key)
+		if raw == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			errs = append(errs, queryError(param.key, param.key+" must be an RFC 3339 timestamp"))
+			continue
+		}
+		*param.dst = t
+	}
+
+	return query, errs
+}
+
+func queryError(field, message string) validate.FieldError {
+	return validate.FieldError{Field: field, Code: codeQueryInvalid, Message: message}
 }
 
 func (app *application) DeleteLinkHandler(w http.ResponseWriter, r *http.Request) {
@@ -90,60 +285,114 @@ func (app *application) DeleteLinkHandler(w http.ResponseWriter, r *http.Request
 
 	link, err := app.store.Links.GetBySlug(r.Context(), slug)
 	if err != nil {
-		http.Error(w, "Not Found", http.StatusNotFound)
+		app.storeError(w, r, err)
 		return
 	}
 
-	if link.Expired_date.Before(time.Now()) {
-		http.Error(w, "Link is expired", http.StatusGone)
+	if link.IsExpired(time.Now()) {
+		app.linkExpired(w, r)
 		return
 	}
 
 	user := r.Context().Value(userCtx).(*store.User)
 	if err := app.store.Links.DeleteBySlug(r.Context(), user.Email, slug); err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		app.storeError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Link is deleted"))
+	app.writeMessage(w, r, http.StatusOK, "Link is deleted")
 }
 
 type UpdateLinkPayload struct {
-	Slug        string `json:"slug"`
-	OriginalUrl string `json:"original_url"`
+	Slug         string `json:"slug" validate:"required"`
+	NewSlug      string `json:"new_slug" validate:"slug"`
+	KeepAlias    bool   `json:"keep_alias"`
+	OriginalUrl  string `json:"original_url" validate:"url"`
+	RedirectType int    `json:"redirect_type" validate:"redirect_type"`
+	ExpiryPayload
 }
 
 func (app *application) UpdateLinkHandler(w http.ResponseWriter, r *http.Request) {
 	
 	var payload UpdateLinkPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Bad request", http.StatusBadRequest)
+	if !app.readJSON(w, r, &payload) {
+		return
+	}
+
+	errs := app.validator.Struct(&payload)
+
+	var expiry time.Time
+	if !payload.ExpiryPayload.empty() {
+		resolved, err := app.resolveExpiry(payload.ExpiryPayload, time.Now())
+		if err != nil {
+			fieldErr, ok := expiryFieldError(err)
+			if !ok {
+				app.internalError(w, r, err)
+				return
+			}
+			errs = append(errs, fieldErr)
+		}
+		expiry = resolved
+	}
+
+	if len(errs) > 0 {
+		app.failedValidation(w, r, errs)
 		return
 	}
 
+	rename := payload.NewSlug != "" && payload.NewSlug != payload.Slug
+
+	var originalUrl string
+	if payload.OriginalUrl != "" {
+		normalized, err := app.urls.Normalize(payload.OriginalUrl)
+		if err != nil {
+			app.internalError(w, r, err)
+			return
+		}
+		originalUrl = normalized
+	}
+
 	link, err := app.store.Links.GetBySlug(r.Context(), payload.Slug)
 	if err != nil {
-		http.Error(w, "Not Found", http.StatusNotFound)
+		app.storeError(w, r, err)
+		return
+	}
+
+	if link.AliasOf != "" {
+		app.linkIsAlias(w, r)
 		return
 	}
 
-	if link.Expired_date.Before(time.Now()) {
-		http.Error(w, "Link is expired", http.StatusGone)
+	if link.IsExpired(time.Now()) {
+		app.linkExpired(w, r)
 		return
 	}
 
-	link.Slug = payload.Slug
-	link.OriginalUrl = payload.OriginalUrl
+	if originalUrl != "" {
+		link.OriginalUrl = originalUrl
+	}
+	if payload.RedirectType != 0 {
+		link.RedirectType = payload.RedirectType
+	}
+
+	if !payload.ExpiryPayload.empty() {
+		link.Expired_date = expiry
+	}
 
 	user := r.Context().Value(userCtx).(*store.User)
-	if err := app.store.Links.UpdateBySlug(r.Context(), user.Email, link); err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+
+	if rename {
+		link.Slug = payload.NewSlug
+		err = app.store.Links.Rename(r.Context(), user.Email, payload.Slug, link, payload.KeepAlias)
+	} else {
+		err = app.store.Links.UpdateBySlug(r.Context(), user.Email, link)
+	}
+	if err != nil {
+		app.storeError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Link is updated"))
+	app.writeData(w, r, http.StatusOK, app.newLinkResponse(link, time.Now()))
 }
 
 func (app *application) RefreshExpiredDateHandler(w http.ResponseWriter, r *http.Request) {
@@ -151,18 +400,34 @@ func (app *application) RefreshExpiredDateHandler(w http.ResponseWriter, r *http
 
 	link, err := app.store.Links.GetBySlug(r.Context(), slug)
 	if err != nil {
-		http.Error(w, "Not Found", http.StatusNotFound)
+		app.storeError(w, r, err)
+		return
+	}
+
+	if link.AliasOf != "" {
+		app.linkIsAlias(w, r)
+		return
+	}
+
+	payload, err := expiryFromQuery(r)
+	if err != nil {
+		app.writeExpiryError(w, r, err)
+		return
+	}
+
+	expiry, err := app.resolveExpiry(payload, time.Now())
+	if err != nil {
+		app.writeExpiryError(w, r, err)
 		return
 	}
 
-	link.Expired_date = time.Now().Add(time.Hour * 24 * 30)
+	link.Expired_date = expiry
 
 	user := r.Context().Value(userCtx).(*store.User)
 	if err := app.store.Links.UpdateBySlug(r.Context(), user.Email, link); err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		app.storeError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Link is updated"))
+	app.writeData(w, r, http.StatusOK, app.newLinkResponse(link, time.Now()))
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/devaartana/e01-oprec-rpl/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const (
+	redirectHit     = "hit"
+	redirectMiss    = "miss"
+	redirectExpired = "expired"
+)
+
+// unmatchedRoute labels requests that matched no route, so random paths
+// can't blow up the number of series.
+const unmatchedRoute = "unmatched"
+
+type metrics struct {
+	registry *prometheus.Registry
+
+	requests  *prometheus.CounterVec
+	latency   *prometheus.HistogramVec
+	redirects *prometheus.CounterVec
+
+	storeLatency *prometheus.HistogramVec
+	storeErrors  *prometheus.CounterVec
+
+	poolOpen             prometheus.Gauge
+	poolInUse            prometheus.Gauge
+	poolCheckoutFailures prometheus.Counter
+	poolCleared          prometheus.Counter
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by method and route pattern.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shortener_redirects_total",
+			Help: "Short link lookups by result: hit, miss or expired.",
+		}, []string{"result"}),
+		storeLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "store_operation_duration_seconds",
+			Help:    "Latency of storage operations by store and method.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"store", "method"}),
+		storeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "store_operation_errors_total",
+			Help: "Failed storage operations by store and method. Not found and duplicate errors are not failures.",
+		}, []string{"store", "method"}),
+		poolOpen: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mongo_pool_connections_open",
+			Help: "Connections held by the Mongo connection pool.",
+		}),
+		poolInUse: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mongo_pool_connections_in_use",
+			Help: "Mongo connections checked out of the pool.",
+		}),
+		poolCheckoutFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "mongo_pool_checkout_failures_total",
+			Help: "Attempts to check out a Mongo connection that failed, e.g. because the pool was exhausted.",
+		}),
+		poolCleared: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "mongo_pool_cleared_total",
+			Help: "Times the Mongo connection pool was cleared after a server error.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.latency,
+		m.redirects,
+		m.storeLatency,
+		m.storeErrors,
+		m.poolOpen,
+		m.poolInUse,
+		m.poolCheckoutFailures,
+		m.poolCleared,
+	)
+
+	return m
+}
+
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// middleware records every request under the route pattern chi matched, e.g.
+// "/{slug}", rather than the path.
+func (m *metrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		next.ServeHTTP(ww, r)
+
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		m.requests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		m.latency.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+func (m *metrics) redirect(result string) {
+	m.redirects.WithLabelValues(result).Inc()
+}
+
+// storeHook is a store.Hook that records the latency and failures of every
+// storage operation.
+func (m *metrics) storeHook(ctx context.Context, name string, method string) (context.Context, func(error)) {
+	start := time.Now()
+
+	return ctx, func(err error) {
+		m.storeLatency.WithLabelValues(name, method).Observe(time.Since(start).Seconds())
+
+		if err != nil && !isExpectedStoreError(err) {
+			m.storeErrors.WithLabelValues(name, method).Inc()
+		}
+	}
+}
+
+// isExpectedStoreError reports whether err is part of the contract of a
+// store, like a missing record, rather than a failure of the database.
+func isExpectedStoreError(err error) bool {
+	for _, expected := range []error{
+		store.ErrNotFound,
+		store.ErrDuplicateEmail,
+		store.ErrDuplicateUsername,
+		store.ErrDuplicateSlug,
+		store.ErrInvalidCursor,
+	} {
+		if errors.Is(err, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// poolMonitor keeps the Mongo pool gauges up to date.
+func (m *metrics) poolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				m.poolOpen.Inc()
+			case event.ConnectionClosed:
+				m.poolOpen.Dec()
+			case event.GetSucceeded:
+				m.poolInUse.Inc()
+			case event.ConnectionReturned:
+				m.poolInUse.Dec()
+			case event.GetFailed:
+				m.poolCheckoutFailures.Inc()
+			case event.PoolCleared:
+				m.poolCleared.Inc()
+			}
+		},
+	}
+}
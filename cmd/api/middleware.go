@@ -2,16 +2,36 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/devaartana/e01-oprec-rpl/internal/auth"
+	"github.com/devaartana/e01-oprec-rpl/internal/store"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type userKey string
 
-const userCtx userKey = "user"
+const (
+	userCtx    userKey = "user"
+	sessionCtx userKey = "session"
+	apiKeyCtx  userKey = "api_key"
+
+	accessLogCtx userKey = "access_log"
+)
+
+const (
+	scopeLinksRead  = "links:read"
+	scopeLinksWrite = "links:write"
+)
+
+var apiKeyScopes = []string{scopeLinksRead, scopeLinksWrite}
+
+// apiKeyTouchInterval throttles how often the last used timestamp of an API
+// key is written, so busy scripts don't cause a write per request.
+const apiKeyTouchInterval = time.Minute
 
 func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -20,6 +40,10 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader != "" {
 			parts := strings.Split(authHeader, " ")
+			if len(parts) == 2 && parts[0] == "ApiKey" {
+				app.authenticateAPIKey(w, r, next, parts[1])
+				return
+			}
 			if len(parts) == 2 && parts[0] == "Bearer" {
 				tokenHeader = parts[1]
 			}
@@ -27,13 +51,12 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 
 		if tokenHeader == "" {
 			cookie, err := r.Cookie("token")
-			fmt.Print(cookie)
 			if err != nil {
 				if err == http.ErrNoCookie {
-					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					app.unauthorized(w, r)
 					return
 				}
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				app.internalError(w, r, err)
 				return
 			}
 			tokenHeader = cookie.Value
@@ -41,24 +64,133 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 
 		jwtToken, err := app.authenticator.ValidateToken(tokenHeader)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			app.unauthorized(w, r)
 			return
 		}
 
 		claims, _ := jwtToken.Claims.(jwt.MapClaims)
 		email, ok := claims["email"].(string)
 		if !ok {
-			http.Error(w, "invalid token claims", http.StatusUnauthorized)
+			app.unauthorized(w, r)
+			return
+		}
+
+		sessionID, ok := claims["sid"].(string)
+		if !ok {
+			app.unauthorized(w, r)
+			return
+		}
+
+		session, err := app.store.Sessions.GetByID(r.Context(), sessionID)
+		if err != nil || session.Email != email || !session.IsActive(time.Now()) {
+			app.unauthorized(w, r)
 			return
 		}
 
 		user, err := app.store.Users.GetByEmail(r.Context(), email)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			app.unauthorized(w, r)
+			return
+		}
+
+		if user.Suspended {
+			writeSuspended(w, r)
 			return
 		}
 
+		setAccessLogUser(r.Context(), user.Email)
+
 		ctx := context.WithValue(r.Context(), userCtx, user)
+		ctx = context.WithValue(ctx, sessionCtx, sessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, raw string) {
+	key, err := app.store.APIKeys.GetByHash(r.Context(), auth.HashToken(raw))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.unauthorized(w, r)
+			return
+		}
+		app.internalError(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	if !key.IsActive(now) {
+		app.unauthorized(w, r)
+		return
+	}
+
+	user, err := app.store.Users.GetByEmail(r.Context(), key.Owner)
+	if err != nil {
+		app.unauthorized(w, r)
+		return
+	}
+
+	if user.Suspended {
+		writeSuspended(w, r)
+		return
+	}
+
+	if now.Sub(key.LastUsed_at) >= apiKeyTouchInterval {
+		if err := app.store.APIKeys.TouchLastUsed(r.Context(), key.ID, now); err != nil {
+			app.loggerFrom(r.Context()).Warnw("failed to update api key last used", "key", key.ID, "error", err)
+		}
+	}
+
+	setAccessLogUser(r.Context(), user.Email)
+
+	ctx := context.WithValue(r.Context(), userCtx, user)
+	ctx = context.WithValue(ctx, apiKeyCtx, key)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RequireScope rejects requests authenticated with an API key that lacks
+// scope. Requests authenticated with a session token are always allowed.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := r.Context().Value(apiKeyCtx).(*store.APIKey)
+			if ok && !key.HasScope(scope) {
+				writeError(w, r, http.StatusForbidden, codeInsufficientScope, "api key is missing the "+scope+" scope")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession rejects requests that are not authenticated with a session
+// token, such as API keys managing other API keys.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(sessionCtx).(string); !ok {
+			writeError(w, r, http.StatusForbidden, codeSessionRequired, "this endpoint requires a login session")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole rejects requests from users that don't have role.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := r.Context().Value(userCtx).(*store.User)
+			if !ok || !user.HasRole(role) {
+				writeError(w, r, http.StatusForbidden, codeForbidden, "this endpoint requires the "+role+" role")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeSuspended(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusForbidden, codeAccountSuspended, "this account has been suspended")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/devaartana/e01-oprec-rpl/internal/store"
+)
+
+// The types below are what the API sends to clients. Handlers map store
+// types to them instead of encoding store types directly, so the storage
+// schema can change without breaking clients and secrets such as password
+// hashes never leave the server.
+
+type UserResponse struct {
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	Suspended bool      `json:"suspended"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newUserResponse(u *store.User) UserResponse {
+	role := u.Role
+	if role == "" {
+		role = store.RoleUser
+	}
+
+	return UserResponse{
+		Username:  u.Username,
+		Email:     u.Email,
+		Role:      role,
+		Suspended: u.Suspended,
+		CreatedAt: u.Created_at,
+	}
+}
+
+func newUserResponses(users []store.User) []UserResponse {
+	response := make([]UserResponse, len(users))
+	for i := range users {
+		response[i] = newUserResponse(&users[i])
+	}
+
+	return response
+}
+
+type LinkResponse struct {
+	Slug         string     `json:"slug"`
+	ShortURL     string     `json:"short_url"`
+	OriginalURL  string     `json:"original_url"`
+	RedirectType int        `json:"redirect_type"`
+	AliasOf      string     `json:"alias_of,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiredDate  *time.Time `json:"expired_date"`
+	IsExpired    bool       `json:"is_expired"`
+	Clicks       int64      `json:"clicks"`
+}
+
+// AdminLinkResponse exposes the owner of a link, which is hidden from
+// regular users.
+type AdminLinkResponse struct {
+	LinkResponse
+	Owner string `json:"owner"`
+}
+
+func (app *application) newLinkResponse(l *store.Link, now time.Time) LinkResponse {
+	return LinkResponse{
+		Slug:         l.Slug,
+		ShortURL:     app.shortURL(l.Slug),
+		OriginalURL:  l.OriginalUrl,
+		RedirectType: l.RedirectStatus(),
+		AliasOf:      l.AliasOf,
+		CreatedAt:    l.Created_at,
+		ExpiredDate:  optionalTime(l.Expired_date),
+		IsExpired:    l.IsExpired(now),
+		Clicks:       l.Clicks,
+	}
+}
+
+// LinkPageResponse is one page of a link listing. NextCursor is left out on
+// the last page.
+type LinkPageResponse struct {
+	Links      []LinkResponse `json:"links"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+func (app *application) shortURL(slug string) string {
+	return strings.TrimSuffix(app.config.link.baseURL, "/") + "/" + slug
+}
+
+type APIKeyResponse struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Scopes      []string   `json:"scopes"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiredDate *time.Time `json:"expired_date"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	Revoked     bool       `json:"revoked"`
+	IsActive    bool       `json:"is_active"`
+}
+
+func newAPIKeyResponse(k *store.APIKey, now time.Time) APIKeyResponse {
+	return APIKeyResponse{
+		ID:          k.ID,
+		Name:        k.Name,
+		Prefix:      k.Prefix,
+		Scopes:      k.Scopes,
+		CreatedAt:   k.Created_at,
+		ExpiredDate: optionalTime(k.Expired_date),
+		LastUsedAt:  optionalTime(k.LastUsed_at),
+		Revoked:     k.Revoked,
+		IsActive:    k.IsActive(now),
+	}
+}
+
+type ClickBucketResponse struct {
+	Time  time.Time `json:"time"`
+	Count int64     `json:"count"`
+}
+
+func newClickBucketResponses(buckets []store.ClickBucket) []ClickBucketResponse {
+	response := make([]ClickBucketResponse, len(buckets))
+	for i, b := range buckets {
+		response[i] = ClickBucketResponse{b.Time, b.Count}
+	}
+
+	return response
+}
+
+// optionalTime maps the zero time, which the store uses for "never", to null.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
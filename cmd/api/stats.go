@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/devaartana/e01-oprec-rpl/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultStatsDays  = 30
+	maxStatsDays      = 365
+	defaultStatsHours = 48
+	maxStatsHours     = 24 * 7
+)
+
+type LinkStatsResponse struct {
+	Slug   string                `json:"slug"`
+	Total  int64                 `json:"total"`
+	Daily  []ClickBucketResponse `json:"daily"`
+	Hourly []ClickBucketResponse `json:"hourly"`
+}
+
+func (app *application) LinkStatsHandler(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	user := r.Context().Value(userCtx).(*store.User)
+
+	link, err := app.store.Links.GetBySlug(r.Context(), slug)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.internalError(w, r, err)
+		return
+	}
+
+	if errors.Is(err, store.ErrNotFound) || link.Owner != user.Email {
+		app.notFound(w, r)
+		return
+	}
+
+	days, ok := queryInt(r, "days", defaultStatsDays, maxStatsDays)
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, codeQueryInvalid, "days must be between 1 and 365", queryError("days", "days must be between 1 and 365"))
+		return
+	}
+
+	hours, ok := queryInt(r, "hours", defaultStatsHours, maxStatsHours)
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, codeQueryInvalid, "hours must be between 1 and 168", queryError("hours", "hours must be between 1 and 168"))
+		return
+	}
+
+	now := time.Now()
+
+	total, err := app.store.Clicks.Count(r.Context(), user.Email, slug)
+	if err != nil {
+		app.internalError(w, r, err)
+		return
+	}
+
+	daily, err := app.store.Clicks.Series(r.Context(), user.Email, slug, store.ClickDaily, now.AddDate(0, 0, -(days-1)))
+	if err != nil {
+		app.internalError(w, r, err)
+		return
+	}
+
+	hourly, err := app.store.Clicks.Series(r.Context(), user.Email, slug, store.ClickHourly, now.Add(-time.Duration(hours-1)*time.Hour))
+	if err != nil {
+		app.internalError(w, r, err)
+		return
+	}
+
+	response := LinkStatsResponse{
+		Slug:   slug,
+		Total:  total,
+		Daily:  newClickBucketResponses(daily),
+		Hourly: newClickBucketResponses(hourly),
+	}
+
+	app.writeData(w, r, http.StatusOK, response)
+}
+
+// queryInt reads a positive integer query parameter no larger than max.
+func queryInt(r *http.Request, key string, fallback, max int) (int, bool) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return fallback, true
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 || n > max {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// hashIP keys the visitor address with a server side salt so that unique
+// visitors can be told apart without storing their IP.
+func (app *application) hashIP(remoteAddr string) string {
+	mac := hmac.New(sha256.New, []byte(app.config.click.ipSalt))
+	mac.Write([]byte(clientIP(remoteAddr)))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/devaartana/e01-oprec-rpl/internal/auth"
+	"github.com/devaartana/e01-oprec-rpl/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// startSession creates a new session for email and returns its first pair of
+// access and refresh tokens.
+func (app *application) startSession(ctx context.Context, email string) (*TokenResponse, error) {
+	id, err := auth.NewID()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := auth.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &store.Session{
+		ID:           id,
+		Email:        email,
+		TokenHash:    auth.HashToken(refreshToken),
+		Created_at:   now,
+		Expired_date: now.Add(app.config.auth.refreshExp),
+	}
+
+	if err := app.store.Sessions.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return app.tokenResponse(email, id, refreshToken)
+}
+
+func (app *application) tokenResponse(email, sessionID, refreshToken string) (*TokenResponse, error) {
+	now := time.Now()
+
+	claims := jwt.MapClaims{
+		"email": email,
+		"sid":   sessionID,
+		"exp":   now.Add(app.config.auth.exp).Unix(),
+		"iat":   now.Unix(),
+		"nbf":   now.Unix(),
+		"iss":   app.config.auth.iss,
+		"aud":   app.config.auth.iss,
+	}
+
+	token, err := app.authenticator.GenerateToken(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		Token:        token,
+		AccessToken:  token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(app.config.auth.exp.Seconds()),
+	}, nil
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+func (app *application) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+
+	if !app.readJSON(w, r, &payload) {
+		return
+	}
+
+	if errs := app.validator.Struct(&payload); len(errs) > 0 {
+		app.failedValidation(w, r, errs)
+		return
+	}
+
+	hash := auth.HashToken(payload.RefreshToken)
+
+	session, err := app.store.Sessions.GetByTokenHash(r.Context(), hash)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.unauthorized(w, r)
+			return
+		}
+		app.internalError(w, r, err)
+		return
+	}
+
+	if !session.IsActive(time.Now()) {
+		app.unauthorized(w, r)
+		return
+	}
+
+	// A refresh token that has already been rotated is being used again, so
+	// either the client or an attacker holds a stolen copy. End the session
+	// for both.
+	if session.TokenHash != hash {
+		app.revokeReusedSession(r.Context(), session)
+		app.unauthorized(w, r)
+		return
+	}
+
+	user, err := app.store.Users.GetByEmail(r.Context(), session.Email)
+	if err != nil {
+		app.unauthorized(w, r)
+		return
+	}
+
+	if user.Suspended {
+		writeSuspended(w, r)
+		return
+	}
+
+	refreshToken, err := auth.NewRefreshToken()
+	if err != nil {
+		app.internalError(w, r, err)
+		return
+	}
+
+	if err := app.store.Sessions.Rotate(r.Context(), session.ID, hash, auth.HashToken(refreshToken)); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			// Another request rotated this token first.
+			app.revokeReusedSession(r.Context(), session)
+			app.unauthorized(w, r)
+			return
+		}
+		app.internalError(w, r, err)
+		return
+	}
+
+	tokens, err := app.tokenResponse(session.Email, session.ID, refreshToken)
+	if err != nil {
+		app.internalError(w, r, err)
+		return
+	}
+
+	app.writeData(w, r, http.StatusOK, tokens)
+}
+
+func (app *application) revokeReusedSession(ctx context.Context, session *store.Session) {
+	app.loggerFrom(ctx).Warnw("refresh token reuse detected, revoking session", "session", session.ID, "email", session.Email)
+
+	if err := app.store.Sessions.Revoke(ctx, session.ID); err != nil {
+		app.loggerFrom(ctx).Errorw("failed to revoke session", "session", session.ID, "error", err)
+	}
+}
+
+func (app *application) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Context().Value(sessionCtx).(string)
+
+	if err := app.store.Sessions.Revoke(r.Context(), sessionID); err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.internalError(w, r, err)
+		return
+	}
+
+	app.writeMessage(w, r, http.StatusOK, "Logged out")
+}
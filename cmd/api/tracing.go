@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const tracerName = "github.com/devaartana/e01-oprec-rpl/cmd/api"
+
+const (
+	exporterNone   = "none"
+	exporterOTLP   = "otlp"
+	exporterStdout = "stdout"
+)
+
+// newTracerProvider installs the global tracer provider and W3C trace context
+// propagation. With the none exporter spans are still created, so trace IDs
+// from incoming requests end up in the logs, but they are never exported.
+// The OTLP exporter is configured with the standard OTEL_EXPORTER_OTLP_*
+// variables and sends to localhost:4318 by default.
+func newTracerProvider(ctx context.Context, cfg tracingConfig) (*sdktrace.TracerProvider, error) {
+	var options []sdktrace.TracerProviderOption
+
+	switch cfg.exporter {
+	case exporterNone:
+	case exporterOTLP:
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+	case exporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+	default:
+		return nil, fmt.Errorf("OTEL_TRACES_EXPORTER must be one of none, otlp or stdout, got %q", cfg.exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", cfg.serviceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	options = append(options,
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.sampleRatio))),
+	)
+
+	provider := sdktrace.NewTracerProvider(options...)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return provider, nil
+}
+
+// traceRequests starts a span for every request, continuing the trace of
+// the caller when it sends a traceparent header. Spans are named after the
+// route pattern once chi has matched it, e.g. "GET /{slug}".
+func traceRequests(next http.Handler) http.Handler {
+	named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		span.SetAttributes(attribute.String("http.request_id", middleware.GetReqID(r.Context())))
+
+		next.ServeHTTP(w, r)
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(attribute.String("http.route", rctx.RoutePattern()))
+		}
+	})
+
+	return otelhttp.NewHandler(named, "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method
+		}),
+	)
+}
+
+// traceStore is a store.Hook that wraps every storage operation in a span.
+func traceStore(ctx context.Context, name string, method string) (context.Context, func(error)) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "store."+name+"."+method,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			attribute.String("store.name", name),
+			attribute.String("store.method", method),
+		),
+	)
+
+	return ctx, func(err error) {
+		if err != nil && !isExpectedStoreError(err) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// loggerFrom returns the application logger annotated with the request ID
+// and the trace and span IDs found in ctx, so log lines can be matched to
+// their trace.
+func (app *application) loggerFrom(ctx context.Context) *zap.SugaredLogger {
+	logger := app.logger
+
+	if id := middleware.GetReqID(ctx); id != "" {
+		logger = logger.With("request_id", id)
+	}
+
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		logger = logger.With(
+			"trace_id", span.TraceID().String(),
+			"span_id", span.SpanID().String(),
+		)
+	}
+
+	return logger
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/devaartana/e01-oprec-rpl/internal/slug"
+	"github.com/devaartana/e01-oprec-rpl/internal/store"
+	"github.com/devaartana/e01-oprec-rpl/internal/urlcheck"
+	"github.com/devaartana/e01-oprec-rpl/internal/validate"
+)
+
+// maxBodyBytes caps the size of JSON request bodies.
+const maxBodyBytes = 1 << 20
+
+// newValidator returns a validator that, next to the generic rules, knows
+// the rules of this API: slug for the slug policy, url for link destinations
+// and redirect_type for redirect status codes.
+func (app *application) newValidator() *validate.Validator {
+	v := validate.New()
+
+	v.Register("slug", func(field string, value reflect.Value, _ string) *validate.FieldError {
+		var slugErr *slug.Error
+		if errors.As(app.slugPolicy.Validate(value.String()), &slugErr) {
+			return &validate.FieldError{Field: field, Code: slugErr.Code, Message: slugErr.Message}
+		}
+		return nil
+	})
+
+	v.Register("url", func(field string, value reflect.Value, _ string) *validate.FieldError {
+		var urlErr *urlcheck.Error
+		if _, err := app.urls.Normalize(value.String()); errors.As(err, &urlErr) {
+			return &validate.FieldError{Field: field, Code: urlErr.Code, Message: urlErr.Message}
+		}
+		return nil
+	})
+
+	v.Register("redirect_type", func(field string, value reflect.Value, _ string) *validate.FieldError {
+		if !store.IsRedirectType(int(value.Int())) {
+			return &validate.FieldError{Field: field, Code: codeRedirectTypeInvalid, Message: field + " must be one of 301, 302, 307 or 308"}
+		}
+		return nil
+	})
+
+	return v
+}
+
+// readJSON decodes a single JSON value from the request body into dst,
+// rejecting unknown fields and bodies larger than maxBodyBytes. It writes
+// the error response itself and reports whether the handler can continue.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(dst)
+	if err == nil {
+		if decoder.Decode(&struct{}{}) != io.EOF {
+			app.badRequest(w, r, "request body must contain a single JSON value")
+			return false
+		}
+		return true
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		app.badRequest(w, r, "request body must not be empty")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		app.badRequest(w, r, "request body must be valid JSON")
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		message := fmt.Sprintf("%s must be a %s", typeErr.Field, jsonType(typeErr.Type))
+		writeError(w, r, http.StatusBadRequest, codeFieldType, message, validate.FieldError{Field: typeErr.Field, Code: codeFieldType, Message: message})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		message := fmt.Sprintf("unknown field %s", field)
+		writeError(w, r, http.StatusBadRequest, codeUnknownField, message, validate.FieldError{Field: field, Code: codeUnknownField, Message: message})
+	case errors.As(err, &maxBytesErr):
+		writeError(w, r, http.StatusRequestEntityTooLarge, codeBodyTooLarge, fmt.Sprintf("request body must not be larger than %d bytes", maxBytesErr.Limit))
+	default:
+		app.badRequest(w, r, "request body must be valid JSON")
+	}
+
+	return false
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	default:
+		return "valid value"
+	}
+}
+
+// failedValidation rejects a request with every field error found in it.
+func (app *application) failedValidation(w http.ResponseWriter, r *http.Request, errs validate.Errors) {
+	writeError(w, r, http.StatusUnprocessableEntity, codeValidationFailed, "request has invalid fields", errs...)
+}
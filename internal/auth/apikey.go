@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// APIKeyPrefix marks API keys so they are easy to spot in configs and logs.
+const APIKeyPrefix = "lsk_"
+
+// apiKeyPrefixLength is how much of a key is kept in plain text so users can
+// tell their keys apart.
+const apiKeyPrefixLength = len(APIKeyPrefix) + 6
+
+// NewAPIKey returns a random API key and its displayable prefix. Only the
+// hash of the key, see HashToken, should be persisted.
+func NewAPIKey() (key string, prefix string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:apiKeyPrefixLength], nil
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeySetProvider is implemented by authenticators whose tokens can be
+// verified by other services with the published key set.
+type KeySetProvider interface {
+	JWKS() JWKS
+}
+
+// AsymmetricAuthenticator signs tokens with the active key and accepts
+// tokens signed by any of its keys, so a new key can be rolled out while
+// tokens signed by the previous one are still valid.
+type AsymmetricAuthenticator struct {
+	keys   map[string]*SigningKey
+	active *SigningKey
+	jwks   JWKS
+	aud    string
+	iss    string
+}
+
+func NewAsymmetricAuthenticator(keys []*SigningKey, activeID, aud, iss string) (*AsymmetricAuthenticator, error) {
+	a := &AsymmetricAuthenticator{
+		keys: make(map[string]*SigningKey),
+		jwks: JWKS{Keys: []JWK{}},
+		aud:  aud,
+		iss:  iss,
+	}
+
+	for _, key := range keys {
+		if _, ok := a.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+
+		jwk, err := key.JWK()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", key.ID, err)
+		}
+
+		a.keys[key.ID] = key
+		a.jwks.Keys = append(a.jwks.Keys, jwk)
+	}
+
+	active, ok := a.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active key %q is not loaded", activeID)
+	}
+
+	if active.Private == nil {
+		return nil, fmt.Errorf("active key %q has no private key", activeID)
+	}
+
+	a.active = active
+
+	return a, nil
+}
+
+func (a *AsymmetricAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(a.active.Method, claims)
+	token.Header["kid"] = a.active.ID
+
+	return token.SignedString(a.active.Private)
+}
+
+func (a *AsymmetricAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
+	return jwt.Parse(token, func(t *jwt.Token) (any, error) {
+		kid, ok := t.Header["kid"].(string)
+		if !ok {
+			return nil, errors.New("token has no key id")
+		}
+
+		key, ok := a.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %v for key %q", t.Header["alg"], kid)
+		}
+
+		return key.Public, nil
+	},
+		jwt.WithExpirationRequired(),
+		jwt.WithAudience(a.aud),
+		jwt.WithIssuer(a.iss),
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+	)
+}
+
+func (a *AsymmetricAuthenticator) JWKS() JWKS {
+	return a.jwks
+}
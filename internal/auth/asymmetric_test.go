@@ -0,0 +1,369 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testAudience = "test-aud"
+	testIssuer   = "test-iss"
+)
+
+func newRSAKey(t *testing.T, bits int) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func mustSigningKey(t *testing.T, id string, key any) *SigningKey {
+	t.Helper()
+
+	signingKey, err := newSigningKey(id, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signingKey
+}
+
+// publicOnly returns key as it is loaded once it has been retired.
+func publicOnly(key *SigningKey) *SigningKey {
+	return &SigningKey{ID: key.ID, Method: key.Method, Public: key.Public}
+}
+
+func mustAuthenticator(t *testing.T, activeID string, keys ...*SigningKey) *AsymmetricAuthenticator {
+	t.Helper()
+
+	a, err := NewAsymmetricAuthenticator(keys, activeID, testAudience, testIssuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a
+}
+
+func testClaims(expiresIn time.Duration) jwt.Claims {
+	return jwt.RegisteredClaims{
+		Subject:   "alice@example.com",
+		Audience:  jwt.ClaimStrings{testAudience},
+		Issuer:    testIssuer,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+	}
+}
+
+func mustToken(t *testing.T, a Authenticator, claims jwt.Claims) string {
+	t.Helper()
+
+	token, err := a.GenerateToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestAsymmetricAuthenticator(t *testing.T) {
+	rsaKey := mustSigningKey(t, "rsa-1", newRSAKey(t, 2048))
+	edKey := mustSigningKey(t, "ed-1", newEd25519Key(t))
+
+	tests := []struct {
+		name string
+		key  *SigningKey
+		alg  string
+	}{
+		{"RS256", rsaKey, "RS256"},
+		{"EdDSA", edKey, "EdDSA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := mustAuthenticator(t, tt.key.ID, tt.key)
+			token := mustToken(t, a, testClaims(time.Hour))
+
+			parsed, err := a.ValidateToken(token)
+			if err != nil {
+				t.Fatalf("ValidateToken: %v", err)
+			}
+			if parsed.Header["kid"] != tt.key.ID || parsed.Header["alg"] != tt.alg {
+				t.Fatalf("got kid %v alg %v, want %s %s", parsed.Header["kid"], parsed.Header["alg"], tt.key.ID, tt.alg)
+			}
+
+			if _, err := a.ValidateToken(mustToken(t, a, testClaims(-time.Minute))); err == nil {
+				t.Fatal("ValidateToken accepted an expired token")
+			}
+
+			other := jwt.RegisteredClaims{
+				Audience:  jwt.ClaimStrings{"other"},
+				Issuer:    testIssuer,
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			}
+			if _, err := a.ValidateToken(mustToken(t, a, other)); err == nil {
+				t.Fatal("ValidateToken accepted a token for another audience")
+			}
+		})
+	}
+}
+
+func TestAsymmetricAuthenticatorRotation(t *testing.T) {
+	oldKey := mustSigningKey(t, "2024", newRSAKey(t, 2048))
+	newKey := mustSigningKey(t, "2025", newEd25519Key(t))
+
+	before := mustAuthenticator(t, oldKey.ID, oldKey)
+	oldToken := mustToken(t, before, testClaims(time.Hour))
+
+	// The new key signs while the retired one still verifies its tokens.
+	during := mustAuthenticator(t, newKey.ID, publicOnly(oldKey), newKey)
+	newToken := mustToken(t, during, testClaims(time.Hour))
+
+	after := mustAuthenticator(t, newKey.ID, newKey)
+
+	tests := []struct {
+		name  string
+		a     *AsymmetricAuthenticator
+		token string
+		valid bool
+	}{
+		{"old token before rotation", before, oldToken, true},
+		{"old token during rotation", during, oldToken, true},
+		{"new token during rotation", during, newToken, true},
+		{"new token before rotation", before, newToken, false},
+		{"old token after retiring the key", after, oldToken, false},
+		{"new token after retiring the key", after, newToken, true},
+	}
+
+	for _, tt := range tests {
+		_, err := tt.a.ValidateToken(tt.token)
+		if tt.valid && err != nil {
+			t.Errorf("%s: ValidateToken: %v", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: ValidateToken accepted the token", tt.name)
+		}
+	}
+}
+
+func TestAsymmetricAuthenticatorRejectsForgedHeaders(t *testing.T) {
+	rsaKey := mustSigningKey(t, "rsa-1", newRSAKey(t, 2048))
+	edPrivate := newEd25519Key(t)
+	a := mustAuthenticator(t, rsaKey.ID, rsaKey, mustSigningKey(t, "ed-1", edPrivate))
+
+	sign := func(method jwt.SigningMethod, kid any, key any) string {
+		token := jwt.NewWithClaims(method, testClaims(time.Hour))
+		if kid != nil {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(rsaKey.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"no key id", sign(jwt.SigningMethodEdDSA, nil, edPrivate)},
+		{"unknown key id", sign(jwt.SigningMethodEdDSA, "ed-2", edPrivate)},
+		{"algorithm of another key", sign(jwt.SigningMethodEdDSA, "rsa-1", edPrivate)},
+		{"HMAC with the public key", sign(jwt.SigningMethodHS256, "rsa-1", publicDER)},
+		{"unsigned", sign(jwt.SigningMethodNone, "rsa-1", jwt.UnsafeAllowNoneSignatureType)},
+	}
+
+	for _, tt := range tests {
+		if _, err := a.ValidateToken(tt.token); err == nil {
+			t.Errorf("%s: ValidateToken accepted the token", tt.name)
+		}
+	}
+}
+
+func TestNewAsymmetricAuthenticatorErrors(t *testing.T) {
+	key := mustSigningKey(t, "ed-1", newEd25519Key(t))
+
+	tests := []struct {
+		name     string
+		keys     []*SigningKey
+		activeID string
+	}{
+		{"duplicate key id", []*SigningKey{key, key}, key.ID},
+		{"active key not loaded", []*SigningKey{key}, "ed-2"},
+		{"active key without private key", []*SigningKey{publicOnly(key)}, key.ID},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewAsymmetricAuthenticator(tt.keys, tt.activeID, testAudience, testIssuer); err == nil {
+			t.Errorf("%s: NewAsymmetricAuthenticator returned no error", tt.name)
+		}
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaPrivate := newRSAKey(t, 2048)
+	edPrivate := newEd25519Key(t)
+
+	active := mustSigningKey(t, "ed-1", edPrivate)
+	retired := publicOnly(mustSigningKey(t, "rsa-1", rsaPrivate))
+	a := mustAuthenticator(t, active.ID, retired, active)
+
+	jwks := a.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(jwks.Keys))
+	}
+
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("%q is not base64url: %v", s, err)
+		}
+		return b
+	}
+
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "sig" {
+			t.Errorf("key %q: use = %q, want sig", jwk.Kid, jwk.Use)
+		}
+
+		var public crypto.PublicKey
+		switch jwk.Kid {
+		case "rsa-1":
+			if jwk.Kty != "RSA" || jwk.Alg != "RS256" || jwk.Crv != "" || jwk.X != "" {
+				t.Fatalf("key %q: got %+v", jwk.Kid, jwk)
+			}
+			public = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(decode(jwk.N)),
+				E: int(new(big.Int).SetBytes(decode(jwk.E)).Int64()),
+			}
+			if !rsaPrivate.PublicKey.Equal(public) {
+				t.Errorf("key %q: JWK does not match the public key", jwk.Kid)
+			}
+		case "ed-1":
+			if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || jwk.Alg != "EdDSA" || jwk.N != "" || jwk.E != "" {
+				t.Fatalf("key %q: got %+v", jwk.Kid, jwk)
+			}
+			public = ed25519.PublicKey(decode(jwk.X))
+			if !edPrivate.Public().(ed25519.PublicKey).Equal(public) {
+				t.Errorf("key %q: JWK does not match the public key", jwk.Kid)
+			}
+		default:
+			t.Fatalf("unexpected key %q", jwk.Kid)
+		}
+	}
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	rsaPrivate := newRSAKey(t, 2048)
+	edPrivate := newEd25519Key(t)
+
+	marshal := func(f func() ([]byte, error)) []byte {
+		b, err := f()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	tests := []struct {
+		name    string
+		block   *pem.Block
+		alg     string
+		canSign bool
+		wantErr bool
+	}{
+		{
+			name:    "RSA PKCS#8",
+			block:   &pem.Block{Type: "PRIVATE KEY", Bytes: marshal(func() ([]byte, error) { return x509.MarshalPKCS8PrivateKey(rsaPrivate) })},
+			alg:     "RS256",
+			canSign: true,
+		},
+		{
+			name:    "RSA PKCS#1",
+			block:   &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaPrivate)},
+			alg:     "RS256",
+			canSign: true,
+		},
+		{
+			name:  "RSA public",
+			block: &pem.Block{Type: "PUBLIC KEY", Bytes: marshal(func() ([]byte, error) { return x509.MarshalPKIXPublicKey(&rsaPrivate.PublicKey) })},
+			alg:   "RS256",
+		},
+		{
+			name:    "Ed25519 PKCS#8",
+			block:   &pem.Block{Type: "PRIVATE KEY", Bytes: marshal(func() ([]byte, error) { return x509.MarshalPKCS8PrivateKey(edPrivate) })},
+			alg:     "EdDSA",
+			canSign: true,
+		},
+		{
+			name:  "Ed25519 public",
+			block: &pem.Block{Type: "PUBLIC KEY", Bytes: marshal(func() ([]byte, error) { return x509.MarshalPKIXPublicKey(edPrivate.Public()) })},
+			alg:   "EdDSA",
+		},
+		{
+			name:    "RSA below 2048 bits",
+			block:   &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(newRSAKey(t, 1024))},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported block",
+			block:   &pem.Block{Type: "CERTIFICATE", Bytes: []byte("not a key")},
+			wantErr: true,
+		},
+	}
+
+	dir := t.TempDir()
+	for i, tt := range tests {
+		path := filepath.Join(dir, string(rune('a'+i))+".pem")
+		if err := os.WriteFile(path, pem.EncodeToMemory(tt.block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		key, err := LoadSigningKey("kid", path)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: LoadSigningKey returned no error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: LoadSigningKey: %v", tt.name, err)
+			continue
+		}
+
+		if key.ID != "kid" || key.Method.Alg() != tt.alg || (key.Private != nil) != tt.canSign {
+			t.Errorf("%s: got kid %q alg %s private %t", tt.name, key.ID, key.Method.Alg(), key.Private != nil)
+		}
+	}
+}
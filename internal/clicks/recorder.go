@@ -0,0 +1,152 @@
+// Package clicks records redirect events in the background so that storing
+// them never delays the redirect itself.
+package clicks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/devaartana/e01-oprec-rpl/internal/store"
+	"go.uber.org/zap"
+)
+
+type Sink interface {
+	CreateMany(ctx context.Context, clicks []store.Click) error
+}
+
+type Recorder struct {
+	sink          Sink
+	logger        *zap.SugaredLogger
+	events        chan store.Click
+	batchSize     int
+	flushInterval time.Duration
+
+	mu      sync.RWMutex
+	closed  bool
+	quit    chan struct{}
+	done    chan struct{}
+	started bool
+}
+
+func NewRecorder(sink Sink, logger *zap.SugaredLogger, bufferSize, batchSize int, flushInterval time.Duration) *Recorder {
+	return &Recorder{
+		sink:          sink,
+		logger:        logger,
+		events:        make(chan store.Click, bufferSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		quit:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+func (r *Recorder) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.started || r.closed {
+		return
+	}
+
+	r.started = true
+	go r.run()
+}
+
+// Record queues a click without blocking. It reports false when the click
+// was dropped because the queue is full or the recorder is closed.
+func (r *Recorder) Record(click store.Click) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		return false
+	}
+
+	select {
+	case r.events <- click:
+		return true
+	default:
+		r.logger.Warnw("click queue is full, dropping click", "slug", click.Slug)
+		return false
+	}
+}
+
+// Running reports whether the background worker is accepting clicks.
+func (r *Recorder) Running() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.started && !r.closed
+}
+
+// Close stops accepting clicks and waits until every queued click has been
+// written or ctx is done.
+func (r *Recorder) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	started := r.started
+	close(r.quit)
+	r.mu.Unlock()
+
+	if !started {
+		return nil
+	}
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]store.Click, 0, r.batchSize)
+
+	for {
+		select {
+		case click := <-r.events:
+			batch = append(batch, click)
+			if len(batch) >= r.batchSize {
+				batch = r.flush(batch)
+			}
+		case <-ticker.C:
+			batch = r.flush(batch)
+		case <-r.quit:
+			for {
+				select {
+				case click := <-r.events:
+					batch = append(batch, click)
+					if len(batch) >= r.batchSize {
+						batch = r.flush(batch)
+					}
+				default:
+					r.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Recorder) flush(batch []store.Click) []store.Click {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	if err := r.sink.CreateMany(context.Background(), batch); err != nil {
+		r.logger.Errorw("failed to store clicks", "error", err, "count", len(batch))
+	}
+
+	return batch[:0]
+}
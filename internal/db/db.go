@@ -8,7 +8,9 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func New(addr string, maxOpenConnection int, maxIdleConnection int, maxIdleTime string) (*mongo.Client, error) {
+// New connects to addr and pings it. opts are applied after the pool settings,
+// e.g. to attach monitors.
+func New(addr string, maxOpenConnection int, maxIdleConnection int, maxIdleTime string, opts ...*options.ClientOptions) (*mongo.Client, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
@@ -22,7 +24,7 @@ func New(addr string, maxOpenConnection int, maxIdleConnection int, maxIdleTime
 		SetMinPoolSize(uint64(maxIdleConnection)). 
 		SetMaxConnIdleTime(idleTimeDuration)
 
-	client, err := mongo.Connect(ctx, clientOption)
+	client, err := mongo.Connect(ctx, append([]*options.ClientOptions{clientOption}, opts...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -1,8 +1,12 @@
 package env
 
 import (
+	"errors"
+	"math"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 func GetString(key, fallback string) string {
@@ -40,4 +44,68 @@ func GetBool(key string, fallback bool) bool {
 	}
 
 	return boolVal
-}
\ No newline at end of file
+}
+
+func GetFloat(key string, fallback float64) float64 {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	valAsFloat, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return fallback
+	}
+
+	return valAsFloat
+}
+
+func GetStrings(key string, fallback []string) []string {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	var values []string
+	for _, v := range strings.Split(val, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+func GetDuration(key string, fallback time.Duration) time.Duration {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	duration, err := ParseDuration(val)
+	if err != nil {
+		return fallback
+	}
+
+	return duration
+}
+
+const maxDays = math.MaxInt64 / int64(24*time.Hour)
+
+var errDurationRange = errors.New("duration out of range")
+
+// ParseDuration extends time.ParseDuration with a "d" suffix for days.
+func ParseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseInt(days, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		if n > maxDays || n < -maxDays {
+			return 0, errDurationRange
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,31 @@
+package env
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetDuration(t *testing.T) {
+	fallback := time.Minute
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"90s", 90 * time.Second},
+		{"72h", 72 * time.Hour},
+		{"30d", 30 * 24 * time.Hour},
+		{"0", 0},
+		{"", fallback},
+		{"soon", fallback},
+		{"106752d", fallback},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TEST_DURATION", tt.value)
+
+		if got := GetDuration("TEST_DURATION", fallback); got != tt.want {
+			t.Errorf("GetDuration(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package slug
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// DefaultAlphabet leaves out characters that are easy to confuse when a link
+// is read aloud or typed by hand (0/O, 1/l/I).
+const DefaultAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const urlSafe = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"
+
+var (
+	ErrInvalidLength   = errors.New("slug length must be positive")
+	ErrInvalidAlphabet = errors.New("slug alphabet must contain at least two distinct URL-safe characters")
+)
+
+type Generator struct {
+	length   int
+	alphabet string
+}
+
+func NewGenerator(length int, alphabet string) (*Generator, error) {
+	if length <= 0 {
+		return nil, ErrInvalidLength
+	}
+
+	seen := make(map[rune]bool)
+	for _, c := range alphabet {
+		if !strings.ContainsRune(urlSafe, c) || seen[c] {
+			return nil, ErrInvalidAlphabet
+		}
+		seen[c] = true
+	}
+
+	if len(seen) < 2 {
+		return nil, ErrInvalidAlphabet
+	}
+
+	return &Generator{length, alphabet}, nil
+}
+
+func (g *Generator) Generate() (string, error) {
+	max := big.NewInt(int64(len(g.alphabet)))
+
+	b := make([]byte, g.length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = g.alphabet[n.Int64()]
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,79 @@
+package slug
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	CodeTooShort     = "slug_too_short"
+	CodeTooLong      = "slug_too_long"
+	CodeInvalidChars = "slug_invalid_characters"
+	CodeReserved     = "slug_reserved"
+)
+
+// DefaultReserved holds slugs that collide with routes served next to the
+// "/{slug}" redirect or that we may want to serve in the future.
+var DefaultReserved = []string{
+	"api", "admin", "login", "logout", "register", "user", "users", "links",
+	"healthz", "readyz", "livez", "metrics", "docs", "openapi", "swagger",
+	"static", "assets", "favicon", "robots", "well-known",
+}
+
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+type Policy struct {
+	minLength int
+	maxLength int
+	reserved  map[string]bool
+}
+
+func NewPolicy(minLength, maxLength int, reserved []string) *Policy {
+	words := make(map[string]bool)
+	for _, word := range reserved {
+		if word = strings.TrimSpace(word); word != "" {
+			words[strings.ToLower(word)] = true
+		}
+	}
+
+	return &Policy{minLength, maxLength, words}
+}
+
+// Validate reports whether slug may be used as a short link. Only ASCII
+// letters, digits, '-' and '_' are allowed so that slugs cannot contain
+// spaces, path separators or look-alike unicode characters.
+func (p *Policy) Validate(slug string) error {
+	for _, c := range slug {
+		if !isAllowed(c) {
+			return &Error{CodeInvalidChars, "slug may only contain letters, digits, '-' and '_'"}
+		}
+	}
+
+	if len(slug) < p.minLength {
+		return &Error{CodeTooShort, fmt.Sprintf("slug must be at least %d characters", p.minLength)}
+	}
+
+	if len(slug) > p.maxLength {
+		return &Error{CodeTooLong, fmt.Sprintf("slug must be at most %d characters", p.maxLength)}
+	}
+
+	if p.reserved[strings.ToLower(slug)] {
+		return &Error{CodeReserved, fmt.Sprintf("slug %q is reserved", slug)}
+	}
+
+	return nil
+}
+
+func isAllowed(c rune) bool {
+	return c >= 'a' && c <= 'z' ||
+		c >= 'A' && c <= 'Z' ||
+		c >= '0' && c <= '9' ||
+		c == '-' || c == '_'
+}
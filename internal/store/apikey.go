@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// APIKey is a long-lived credential for scripts and bots. Only the hash of
+// the key is stored; Prefix is kept so users can recognise their keys.
+type APIKey struct {
+	ID           string    `bson:"_id" json:"id"`
+	Owner        string    `bson:"owner" json:"-"`
+	Name         string    `bson:"name" json:"name"`
+	Prefix       string    `bson:"prefix" json:"prefix"`
+	Hash         string    `bson:"hash" json:"-"`
+	Scopes       []string  `bson:"scopes" json:"scopes"`
+	Created_at   time.Time `bson:"created_at" json:"created_at"`
+	Expired_date time.Time `bson:"expired_date" json:"expired_date"`
+	LastUsed_at  time.Time `bson:"last_used_at" json:"last_used_at"`
+	Revoked      bool      `bson:"revoked" json:"revoked"`
+}
+
+// IsActive reports whether the key can be used at now. A zero expiry date
+// means the key never expires.
+func (k *APIKey) IsActive(now time.Time) bool {
+	return !k.Revoked && (k.Expired_date.IsZero() || k.Expired_date.After(now))
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+type APIKeyStore struct {
+	db *mongo.Client
+}
+
+func (s *APIKeyStore) keys() *mongo.Collection {
+	return s.db.Database(DB).Collection(APIKeyCollection)
+}
+
+func (s *APIKeyStore) Create(ctx context.Context, key *APIKey) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.keys().InsertOne(ctx, key)
+	return err
+}
+
+func (s *APIKeyStore) GetByHash(ctx context.Context, hash string) (*APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var key APIKey
+	if err := s.keys().FindOne(ctx, bson.M{"hash": hash}).Decode(&key); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (s *APIKeyStore) GetAll(ctx context.Context, email string) ([]APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	options := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := s.keys().Find(ctx, bson.M{"owner": email}, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (s *APIKeyStore) Revoke(ctx context.Context, email string, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.keys().UpdateOne(ctx, bson.M{"_id": id, "owner": email}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *APIKeyStore) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.keys().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$max": bson.M{"last_used_at": at}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
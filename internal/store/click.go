@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Click struct {
+	Slug      string    `bson:"slug" json:"slug"`
+	Owner     string    `bson:"owner" json:"-"`
+	Timestamp time.Time `bson:"timestamp" json:"timestamp"`
+	Referrer  string    `bson:"referrer,omitempty" json:"referrer,omitempty"`
+	UserAgent string    `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	IPHash    string    `bson:"ip_hash,omitempty" json:"ip_hash,omitempty"`
+	RequestID string    `bson:"request_id,omitempty" json:"request_id,omitempty"`
+}
+
+type ClickInterval string
+
+const (
+	ClickDaily  ClickInterval = "day"
+	ClickHourly ClickInterval = "hour"
+)
+
+type ClickBucket struct {
+	Time  time.Time `bson:"_id" json:"time"`
+	Count int64     `bson:"count" json:"count"`
+}
+
+type ClickStore struct {
+	db *mongo.Client
+}
+
+func (c *ClickStore) clicks() *mongo.Collection {
+	return c.db.Database(DB).Collection(ClickCollection)
+}
+
+func (c *ClickStore) CreateMany(ctx context.Context, clicks []Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	documents := make([]any, len(clicks))
+	for i := range clicks {
+		documents[i] = clicks[i]
+	}
+
+	if _, err := c.clicks().InsertMany(ctx, documents, options.InsertMany().SetOrdered(false)); err != nil {
+		return err
+	}
+
+	// Links keep a running total so the listing can sort by clicks without
+	// counting them on every request.
+	updates := []mongo.WriteModel{}
+	for key, count := range countClicks(clicks) {
+		updates = append(updates, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"owner": key.owner, "slug": key.slug}).
+			SetUpdate(bson.M{"$inc": bson.M{"clicks": count}}))
+	}
+
+	links := c.db.Database(DB).Collection(LinkCollection)
+	_, err := links.BulkWrite(ctx, updates, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+type clickKey struct {
+	owner string
+	slug  string
+}
+
+func countClicks(clicks []Click) map[clickKey]int64 {
+	counts := make(map[clickKey]int64)
+	for _, click := range clicks {
+		counts[clickKey{click.Owner, click.Slug}]++
+	}
+	return counts
+}
+
+func (c *ClickStore) Count(ctx context.Context, email string, slug string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return c.clicks().CountDocuments(ctx, bson.M{"owner": email, "slug": slug})
+}
+
+func (c *ClickStore) Series(ctx context.Context, email string, slug string, interval ClickInterval, since time.Time) ([]ClickBucket, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	since = truncate(since, interval)
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"owner":     email,
+			"slug":      slug,
+			"timestamp": bson.M{"$gte": since},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"$dateTrunc": bson.M{
+				"date": "$timestamp",
+				"unit": string(interval),
+			}},
+			"count": bson.M{"$sum": 1},
+		}}},
+	}
+
+	cursor, err := c.clicks().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var buckets []ClickBucket
+	if err := cursor.All(ctx, &buckets); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[time.Time]int64, len(buckets))
+	for _, b := range buckets {
+		counts[b.Time.UTC()] = b.Count
+	}
+
+	return fillBuckets(counts, interval, since, time.Now()), nil
+}
+
+func truncate(t time.Time, interval ClickInterval) time.Time {
+	t = t.UTC()
+	if interval == ClickDaily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	return t.Truncate(time.Hour)
+}
+
+// fillBuckets turns sparse per-bucket counts into a series with one entry per
+// interval from since up to and including the bucket that holds until.
+func fillBuckets(counts map[time.Time]int64, interval ClickInterval, since, until time.Time) []ClickBucket {
+	buckets := []ClickBucket{}
+
+	end := truncate(until, interval)
+	for t := truncate(since, interval); !t.After(end); {
+		buckets = append(buckets, ClickBucket{Time: t, Count: counts[t]})
+
+		if interval == ClickDaily {
+			t = t.AddDate(0, 0, 1)
+		} else {
+			t = t.Add(time.Hour)
+		}
+	}
+
+	return buckets
+}
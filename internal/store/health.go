@@ -0,0 +1,17 @@
+package store
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+type HealthStore struct {
+	db *mongo.Client
+}
+
+// Ping reports whether the primary can be reached before ctx is done.
+func (h *HealthStore) Ping(ctx context.Context) error {
+	return h.db.Ping(ctx, readpref.Primary())
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	emailIndex    = "email_unique"
+	usernameIndex = "username_unique"
+	slugIndex     = "slug_unique"
+)
+
+// EnsureIndexes creates the indexes the stores rely on for uniqueness. It is
+// idempotent and meant to be called once at startup.
+func EnsureIndexes(ctx context.Context, db *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	users := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetName(emailIndex).SetUnique(true),
+		},
+		{
+			// Older accounts could register without a username, so only
+			// non-empty usernames have to be unique.
+			Keys: bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetName(usernameIndex).SetUnique(true).
+				SetPartialFilterExpression(bson.M{"username": bson.M{"$gt": ""}}),
+		},
+	}
+
+	if _, err := db.Database(DB).Collection(Collection).Indexes().CreateMany(ctx, users); err != nil {
+		return err
+	}
+
+	links := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "slug", Value: 1}},
+			Options: options.Index().SetName(slugIndex).SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "owner", Value: 1}, {Key: "created_at", Value: 1}},
+			Options: options.Index().SetName("owner_created_at"),
+		},
+		{
+			// The listing pages by the sort field and then by slug.
+			Keys:    bson.D{{Key: "owner", Value: 1}, {Key: "created_at", Value: 1}, {Key: "slug", Value: 1}},
+			Options: options.Index().SetName("owner_created_at_slug"),
+		},
+		{
+			Keys:    bson.D{{Key: "owner", Value: 1}, {Key: "expired_date", Value: 1}, {Key: "slug", Value: 1}},
+			Options: options.Index().SetName("owner_expired_date_slug"),
+		},
+		{
+			Keys:    bson.D{{Key: "owner", Value: 1}, {Key: "clicks", Value: 1}, {Key: "slug", Value: 1}},
+			Options: options.Index().SetName("owner_clicks_slug"),
+		},
+	}
+
+	if _, err := db.Database(DB).Collection(LinkCollection).Indexes().CreateMany(ctx, links); err != nil {
+		return err
+	}
+
+	clicks := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "owner", Value: 1}, {Key: "slug", Value: 1}, {Key: "timestamp", Value: 1}},
+			Options: options.Index().SetName("owner_slug_timestamp"),
+		},
+	}
+
+	if _, err := db.Database(DB).Collection(ClickCollection).Indexes().CreateMany(ctx, clicks); err != nil {
+		return err
+	}
+
+	sessions := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetName("token_hash_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "previous_hashes", Value: 1}},
+			Options: options.Index().SetName("previous_hashes"),
+		},
+		{
+			// Expired sessions are useless, let Mongo clean them up.
+			Keys:    bson.D{{Key: "expired_date", Value: 1}},
+			Options: options.Index().SetName("expired_date_ttl").SetExpireAfterSeconds(0),
+		},
+	}
+
+	if _, err := db.Database(DB).Collection(SessionCollection).Indexes().CreateMany(ctx, sessions); err != nil {
+		return err
+	}
+
+	apiKeys := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetName("hash_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "owner", Value: 1}, {Key: "created_at", Value: 1}},
+			Options: options.Index().SetName("owner_created_at"),
+		},
+	}
+
+	_, err := db.Database(DB).Collection(APIKeyCollection).Indexes().CreateMany(ctx, apiKeys)
+	return err
+}
+
+// duplicateKeyError maps a Mongo duplicate key error to the sentinel error of
+// the unique index that rejected the write.
+func duplicateKeyError(err error) error {
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, emailIndex):
+		return ErrDuplicateEmail
+	case strings.Contains(msg, usernameIndex):
+		return ErrDuplicateUsername
+	case strings.Contains(msg, slugIndex):
+		return ErrDuplicateSlug
+	}
+
+	return err
+}
@@ -0,0 +1,235 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Hook is called before every operation of an instrumented storage, with
+// the name of the store and the method. The operation runs with the returned
+// context and done is called with its error once it has finished.
+type Hook func(ctx context.Context, store string, method string) (_ context.Context, done func(err error))
+
+// Instrument returns a storage that calls hook around every operation of s.
+// Health checks are passed through untouched.
+func Instrument(s Storage, hook Hook) Storage {
+	i := &instrumented{next: s, hook: hook}
+
+	return Storage{
+		Users:    (*instrumentedUsers)(i),
+		Links:    (*instrumentedLinks)(i),
+		Clicks:   (*instrumentedClicks)(i),
+		Sessions: (*instrumentedSessions)(i),
+		APIKeys:  (*instrumentedAPIKeys)(i),
+		Health:   s.Health,
+	}
+}
+
+type instrumented struct {
+	next Storage
+	hook Hook
+}
+
+type (
+	instrumentedUsers    instrumented
+	instrumentedLinks    instrumented
+	instrumentedClicks   instrumented
+	instrumentedSessions instrumented
+	instrumentedAPIKeys  instrumented
+)
+
+func (s *instrumentedUsers) GetAllUsers(ctx context.Context) (_ []User, err error) {
+	ctx, done := s.hook(ctx, "users", "GetAllUsers")
+	defer func() { done(err) }()
+
+	return s.next.Users.GetAllUsers(ctx)
+}
+
+func (s *instrumentedUsers) Create(ctx context.Context, user *User) (err error) {
+	ctx, done := s.hook(ctx, "users", "Create")
+	defer func() { done(err) }()
+
+	return s.next.Users.Create(ctx, user)
+}
+
+func (s *instrumentedUsers) Update(ctx context.Context, user *User) (err error) {
+	ctx, done := s.hook(ctx, "users", "Update")
+	defer func() { done(err) }()
+
+	return s.next.Users.Update(ctx, user)
+}
+
+func (s *instrumentedUsers) GetByEmail(ctx context.Context, email string) (_ *User, err error) {
+	ctx, done := s.hook(ctx, "users", "GetByEmail")
+	defer func() { done(err) }()
+
+	return s.next.Users.GetByEmail(ctx, email)
+}
+
+func (s *instrumentedUsers) DeleteByEmail(ctx context.Context, email string) (err error) {
+	ctx, done := s.hook(ctx, "users", "DeleteByEmail")
+	defer func() { done(err) }()
+
+	return s.next.Users.DeleteByEmail(ctx, email)
+}
+
+func (s *instrumentedUsers) SetRole(ctx context.Context, email string, role string) (err error) {
+	ctx, done := s.hook(ctx, "users", "SetRole")
+	defer func() { done(err) }()
+
+	return s.next.Users.SetRole(ctx, email, role)
+}
+
+func (s *instrumentedUsers) SetSuspended(ctx context.Context, email string, suspended bool) (err error) {
+	ctx, done := s.hook(ctx, "users", "SetSuspended")
+	defer func() { done(err) }()
+
+	return s.next.Users.SetSuspended(ctx, email, suspended)
+}
+
+func (s *instrumentedLinks) Create(ctx context.Context, email string, link *Link) (err error) {
+	ctx, done := s.hook(ctx, "links", "Create")
+	defer func() { done(err) }()
+
+	return s.next.Links.Create(ctx, email, link)
+}
+
+func (s *instrumentedLinks) GetBySlug(ctx context.Context, slug string) (_ *Link, err error) {
+	ctx, done := s.hook(ctx, "links", "GetBySlug")
+	defer func() { done(err) }()
+
+	return s.next.Links.GetBySlug(ctx, slug)
+}
+
+func (s *instrumentedLinks) GetAll(ctx context.Context, email string) (_ []Link, err error) {
+	ctx, done := s.hook(ctx, "links", "GetAll")
+	defer func() { done(err) }()
+
+	return s.next.Links.GetAll(ctx, email)
+}
+
+func (s *instrumentedLinks) List(ctx context.Context, email string, query LinkQuery) (_ *LinkPage, err error) {
+	ctx, done := s.hook(ctx, "links", "List")
+	defer func() { done(err) }()
+
+	return s.next.Links.List(ctx, email, query)
+}
+
+func (s *instrumentedLinks) GetAllLinks(ctx context.Context) (_ []Link, err error) {
+	ctx, done := s.hook(ctx, "links", "GetAllLinks")
+	defer func() { done(err) }()
+
+	return s.next.Links.GetAllLinks(ctx)
+}
+
+func (s *instrumentedLinks) DeleteBySlug(ctx context.Context, email string, slug string) (err error) {
+	ctx, done := s.hook(ctx, "links", "DeleteBySlug")
+	defer func() { done(err) }()
+
+	return s.next.Links.DeleteBySlug(ctx, email, slug)
+}
+
+func (s *instrumentedLinks) UpdateBySlug(ctx context.Context, email string, link *Link) (err error) {
+	ctx, done := s.hook(ctx, "links", "UpdateBySlug")
+	defer func() { done(err) }()
+
+	return s.next.Links.UpdateBySlug(ctx, email, link)
+}
+
+func (s *instrumentedLinks) Rename(ctx context.Context, email string, oldSlug string, link *Link, keepAlias bool) (err error) {
+	ctx, done := s.hook(ctx, "links", "Rename")
+	defer func() { done(err) }()
+
+	return s.next.Links.Rename(ctx, email, oldSlug, link, keepAlias)
+}
+
+func (s *instrumentedClicks) CreateMany(ctx context.Context, clicks []Click) (err error) {
+	ctx, done := s.hook(ctx, "clicks", "CreateMany")
+	defer func() { done(err) }()
+
+	return s.next.Clicks.CreateMany(ctx, clicks)
+}
+
+func (s *instrumentedClicks) Count(ctx context.Context, email string, slug string) (_ int64, err error) {
+	ctx, done := s.hook(ctx, "clicks", "Count")
+	defer func() { done(err) }()
+
+	return s.next.Clicks.Count(ctx, email, slug)
+}
+
+func (s *instrumentedClicks) Series(ctx context.Context, email string, slug string, interval ClickInterval, since time.Time) (_ []ClickBucket, err error) {
+	ctx, done := s.hook(ctx, "clicks", "Series")
+	defer func() { done(err) }()
+
+	return s.next.Clicks.Series(ctx, email, slug, interval, since)
+}
+
+func (s *instrumentedSessions) Create(ctx context.Context, session *Session) (err error) {
+	ctx, done := s.hook(ctx, "sessions", "Create")
+	defer func() { done(err) }()
+
+	return s.next.Sessions.Create(ctx, session)
+}
+
+func (s *instrumentedSessions) GetByID(ctx context.Context, id string) (_ *Session, err error) {
+	ctx, done := s.hook(ctx, "sessions", "GetByID")
+	defer func() { done(err) }()
+
+	return s.next.Sessions.GetByID(ctx, id)
+}
+
+func (s *instrumentedSessions) GetByTokenHash(ctx context.Context, hash string) (_ *Session, err error) {
+	ctx, done := s.hook(ctx, "sessions", "GetByTokenHash")
+	defer func() { done(err) }()
+
+	return s.next.Sessions.GetByTokenHash(ctx, hash)
+}
+
+func (s *instrumentedSessions) Rotate(ctx context.Context, id string, oldHash string, newHash string) (err error) {
+	ctx, done := s.hook(ctx, "sessions", "Rotate")
+	defer func() { done(err) }()
+
+	return s.next.Sessions.Rotate(ctx, id, oldHash, newHash)
+}
+
+func (s *instrumentedSessions) Revoke(ctx context.Context, id string) (err error) {
+	ctx, done := s.hook(ctx, "sessions", "Revoke")
+	defer func() { done(err) }()
+
+	return s.next.Sessions.Revoke(ctx, id)
+}
+
+func (s *instrumentedAPIKeys) Create(ctx context.Context, key *APIKey) (err error) {
+	ctx, done := s.hook(ctx, "api_keys", "Create")
+	defer func() { done(err) }()
+
+	return s.next.APIKeys.Create(ctx, key)
+}
+
+func (s *instrumentedAPIKeys) GetByHash(ctx context.Context, hash string) (_ *APIKey, err error) {
+	ctx, done := s.hook(ctx, "api_keys", "GetByHash")
+	defer func() { done(err) }()
+
+	return s.next.APIKeys.GetByHash(ctx, hash)
+}
+
+func (s *instrumentedAPIKeys) GetAll(ctx context.Context, email string) (_ []APIKey, err error) {
+	ctx, done := s.hook(ctx, "api_keys", "GetAll")
+	defer func() { done(err) }()
+
+	return s.next.APIKeys.GetAll(ctx, email)
+}
+
+func (s *instrumentedAPIKeys) Revoke(ctx context.Context, email string, id string) (err error) {
+	ctx, done := s.hook(ctx, "api_keys", "Revoke")
+	defer func() { done(err) }()
+
+	return s.next.APIKeys.Revoke(ctx, email, id)
+}
+
+func (s *instrumentedAPIKeys) TouchLastUsed(ctx context.Context, id string, at time.Time) (err error) {
+	ctx, done := s.hook(ctx, "api_keys", "TouchLastUsed")
+	defer func() { done(err) }()
+
+	return s.next.APIKeys.TouchLastUsed(ctx, id, at)
+}
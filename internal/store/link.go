@@ -2,6 +2,8 @@ package store
 
 import (
 	"context"
+	"errors"
+	"net/http"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -11,9 +13,42 @@ import (
 
 type Link struct {
 	Slug         string    `bson:"slug" json:"slug"`
+	Owner        string    `bson:"owner" json:"-"`
 	OriginalUrl  string    `bson:"original_url" json:"original_url"`
 	Created_at   time.Time `bson:"created_at" json:"created_at"`
 	Expired_date time.Time `bson:"expired_date" json:"expired_date"`
+	RedirectType int       `bson:"redirect_type,omitempty" json:"redirect_type"`
+	AliasOf      string    `bson:"alias_of,omitempty" json:"alias_of,omitempty"`
+	Clicks       int64     `bson:"clicks" json:"clicks"`
+}
+
+// DefaultRedirectType is used for links that were created before the redirect
+// type could be chosen. A temporary redirect is not cached by browsers, so
+// later updates and expiry take effect for returning visitors.
+const DefaultRedirectType = http.StatusFound
+
+// IsExpired reports whether the link has expired at now. A zero expiry date
+// means the link never expires.
+func (l *Link) IsExpired(now time.Time) bool {
+	return !l.Expired_date.IsZero() && l.Expired_date.Before(now)
+}
+
+// RedirectStatus returns the HTTP status code the link redirects with.
+func (l *Link) RedirectStatus() int {
+	if l.RedirectType == 0 {
+		return DefaultRedirectType
+	}
+
+	return l.RedirectType
+}
+
+func IsRedirectType(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+
+	return false
 }
 
 type UserLinks struct {
@@ -25,155 +60,264 @@ type LinkStore struct {
 	db *mongo.Client
 }
 
-func (l *LinkStore) Create(ctx context.Context, email string, link *Link) error {
+func (l *LinkStore) links() *mongo.Collection {
+	return l.db.Database(DB).Collection(LinkCollection)
+}
 
+func (l *LinkStore) users() *mongo.Collection {
+	return l.db.Database(DB).Collection(Collection)
+}
+
+func (l *LinkStore) Create(ctx context.Context, email string, link *Link) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	if condition := l.SlugExist(ctx, link.Slug); condition {
-		return ErrDuplicateSlug
+	count, err := l.users().CountDocuments(ctx, bson.M{"email": email})
+	if err != nil {
+		return err
 	}
 
-	filter := bson.M{"email": email}
-	update := bson.M{
-        "$push": bson.M{"links": link}, 
-    }
+	if count == 0 {
+		return ErrNotFound
+	}
 
-    _, err := l.db.Database(DB).Collection(Collection).UpdateOne(ctx, filter, update)
-	if err != nil {
+	// The unique index on slug only covers the links collection, links that
+	// are still embedded in a user document have to be checked by hand.
+	if _, err := l.legacyGetBySlug(ctx, link.Slug); err != ErrNotFound {
+		if err == nil {
+			return ErrDuplicateSlug
+		}
 		return err
 	}
 
+	link.Owner = email
+
+	if _, err := l.links().InsertOne(ctx, link); err != nil {
+		return duplicateKeyError(err)
+	}
+
 	return nil
 }
 
 func (l *LinkStore) GetBySlug(ctx context.Context, slug string) (*Link, error) {
-    ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-    defer cancel()
-
-    filter := bson.M{
-        "links": bson.M{
-            "$elemMatch": bson.M{
-                "slug": slug, 
-			},
-		},
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var link Link
+	err := l.links().FindOne(ctx, bson.M{"slug": slug}).Decode(&link)
+	if err == nil {
+		return &link, nil
 	}
-    
-    projection := bson.M{
-        "links.$": 1,
-        "_id": 0,
-    }
-    
-    options := options.FindOne().SetProjection(projection)
-    
-    var result struct {
-        Links []Link `bson:"links"` 
-    }
 
-    if err := l.db.Database(DB).Collection(Collection).FindOne(ctx, filter, options).Decode(&result); err != nil {
-        if err == mongo.ErrNoDocuments {
-            return nil, ErrNotFound
-        }
-        return nil, err
-    }
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
 
-    return &result.Links[0], nil
+	return l.legacyGetBySlug(ctx, slug)
 }
 
 func (l *LinkStore) SlugExist(ctx context.Context, slug string) bool {
+	_, err := l.GetBySlug(ctx, slug)
+	return err == nil
+}
+
+func (l *LinkStore) GetAll(ctx context.Context, email string) ([]Link, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	filter := bson.M{
-		"links": bson.M{
-			"$elemMatch": bson.M{
-				"slug": slug, 
-			},
-		},
+	// Links that have not been migrated yet still live in the user document,
+	// which is also how we tell an unknown user apart from one without links.
+	legacy, err := l.legacyGetAll(ctx, email)
+	if err != nil {
+		return nil, err
 	}
-	var link Link
-	if err := l.db.Database(DB).Collection(Collection).FindOne(ctx, filter).Decode(&link); err != nil {
-		return false
+
+	options := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := l.links().Find(ctx, bson.M{"owner": email}, options)
+	if err != nil {
+		return nil, err
 	}
+	defer cursor.Close(ctx)
 
-	return true
+	links := []Link{}
+	if err := cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+
+	return append(legacy, links...), nil
 }
 
-func (l *LinkStore) GetAll(ctx context.Context, email string) ([]Link, error) {
-    ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-    defer cancel()
+// GetAllLinks returns the links of every user, oldest first.
+func (l *LinkStore) GetAllLinks(ctx context.Context) ([]Link, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
 
-    filter := bson.M{"email": email}
-    projection := bson.M{"links": 1, "_id": 0}
-    options := options.FindOne().SetProjection(projection)
+	legacy, err := l.legacyGetAllLinks(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-    var result struct {
-        Links []Link `bson:"links"`
-    }
+	options := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
 
-    err := l.db.Database(DB).Collection(Collection).FindOne(ctx, filter, options).Decode(&result)
-    if err != nil {
-        if err == mongo.ErrNoDocuments {
-            return nil, ErrNotFound
-        }
-        return nil, err
-    }
+	cursor, err := l.links().Find(ctx, bson.M{}, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
 
-    return result.Links, nil
+	links := []Link{}
+	if err := cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+
+	return append(legacy, links...), nil
 }
 
+// DeleteBySlug deletes a link of email together with its clicks and the
+// aliases that redirect to it.
 func (l *LinkStore) DeleteBySlug(ctx context.Context, email string, slug string) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	filter := bson.M{
-        "email": email,
-    }
-
-    update := bson.M{
-        "$pull": bson.M{
-            "links": bson.M{
-                "slug": slug,
-            },
-        },
-    }
-
-    result, err := l.db.Database(DB).Collection(Collection).UpdateOne(ctx, filter, update)
-    if err != nil {
-        return err
-    }
-	
-	if result.ModifiedCount == 0 {
-        return ErrNotFound
-    }
+	return withTransaction(ctx, l.db, func(ctx context.Context) error {
+		result, err := l.links().DeleteOne(ctx, bson.M{"slug": slug, "owner": email})
+		if err != nil {
+			return err
+		}
 
-	return nil
-}	
+		if result.DeletedCount == 0 {
+			if err := l.legacyDeleteBySlug(ctx, email, slug); err != nil {
+				return err
+			}
+		}
+
+		_, err = l.links().DeleteMany(ctx, bson.M{"owner": email, "alias_of": slug})
+		if err != nil {
+			return err
+		}
+
+		_, err = l.db.Database(DB).Collection(ClickCollection).DeleteMany(ctx, bson.M{"owner": email, "slug": slug})
+		return err
+	})
+}
 
 func (l *LinkStore) UpdateBySlug(ctx context.Context, email string, link *Link) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
 	filter := bson.M{
-        "email": email,
-        "links.slug": link.Slug,
-    }
+		"slug":  link.Slug,
+		"owner": email,
+	}
 
 	update := bson.M{
-        "$set": bson.M{
-            "links.$.original_url": link.OriginalUrl, 
-            "links.$.expired_date": link.Expired_date,
-        },
-    }
+		"$set": bson.M{
+			"original_url":  link.OriginalUrl,
+			"expired_date":  link.Expired_date,
+			"redirect_type": link.RedirectType,
+		},
+	}
 
-	result, err := l.db.Database(DB).Collection(Collection).UpdateOne(ctx, filter, update)
+	result, err := l.links().UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
 
 	if result.MatchedCount == 0 {
-		return ErrNotFound
+		return l.legacyUpdateBySlug(ctx, email, link)
 	}
 
 	return nil
 }
+
+// Rename moves the link owned by email from oldSlug to link.Slug and writes
+// the other fields of link in the same update. The unique slug index makes
+// the rename fail with ErrDuplicateSlug when the new slug is taken. Clicks
+// and aliases follow the link to its new slug, and with keepAlias the old
+// slug stays reserved as an alias that redirects to the renamed link.
+//
+// The writes share a transaction where the deployment supports one. Without
+// it the new slug is claimed first, so a taken slug still changes nothing,
+// and with keepAlias the old document is turned into the alias in place, so
+// the old slug is never free for someone else to take in between.
+func (l *LinkStore) Rename(ctx context.Context, email string, oldSlug string, link *Link, keepAlias bool) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	newSlug := link.Slug
+
+	return withTransaction(ctx, l.db, func(ctx context.Context) error {
+		if _, err := l.legacyGetBySlug(ctx, newSlug); !errors.Is(err, ErrNotFound) {
+			if err == nil {
+				return ErrDuplicateSlug
+			}
+			return err
+		}
+
+		filter := bson.M{"slug": oldSlug, "owner": email}
+
+		var old Link
+		err := l.links().FindOne(ctx, filter).Decode(&old)
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			if err := l.legacyRename(ctx, email, oldSlug, link); err != nil {
+				return err
+			}
+			if keepAlias {
+				if _, err := l.links().InsertOne(ctx, aliasOf(link, oldSlug)); err != nil {
+					return duplicateKeyError(err)
+				}
+			}
+		case err != nil:
+			return err
+		case keepAlias:
+			renamed := old
+			renamed.Slug = newSlug
+			renamed.OriginalUrl = link.OriginalUrl
+			renamed.Expired_date = link.Expired_date
+			renamed.RedirectType = link.RedirectType
+
+			if _, err := l.links().InsertOne(ctx, renamed); err != nil {
+				return duplicateKeyError(err)
+			}
+
+			if _, err := l.links().ReplaceOne(ctx, filter, aliasOf(link, oldSlug)); err != nil {
+				return err
+			}
+		default:
+			update := bson.M{"$set": bson.M{
+				"slug":          newSlug,
+				"original_url":  link.OriginalUrl,
+				"expired_date":  link.Expired_date,
+				"redirect_type": link.RedirectType,
+			}}
+
+			if _, err := l.links().UpdateOne(ctx, filter, update); err != nil {
+				return duplicateKeyError(err)
+			}
+		}
+
+		_, err = l.links().UpdateMany(ctx, bson.M{"owner": email, "alias_of": oldSlug}, bson.M{"$set": bson.M{"alias_of": newSlug}})
+		if err != nil {
+			return err
+		}
+
+		clicks := l.db.Database(DB).Collection(ClickCollection)
+		_, err = clicks.UpdateMany(ctx, bson.M{"owner": email, "slug": oldSlug}, bson.M{"$set": bson.M{"slug": newSlug}})
+		return err
+	})
+}
+
+// aliasOf returns the alias left behind at oldSlug when link is renamed.
+func aliasOf(link *Link, oldSlug string) *Link {
+	return &Link{
+		Slug:         oldSlug,
+		Owner:        link.Owner,
+		OriginalUrl:  link.OriginalUrl,
+		Created_at:   time.Now(),
+		Expired_date: link.Expired_date,
+		RedirectType: link.RedirectType,
+		AliasOf:      link.Slug,
+	}
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Links used to be embedded as an array in each user document. Until
+// MigrateEmbeddedLinks has run, LinkStore falls back to these lookups so
+// existing short links keep working while the migration is in progress.
+
+func (l *LinkStore) legacyGetBySlug(ctx context.Context, slug string) (*Link, error) {
+	filter := bson.M{
+		"links": bson.M{
+			"$elemMatch": bson.M{
+				"slug": slug,
+			},
+		},
+	}
+
+	projection := bson.M{
+		"email":   1,
+		"links.$": 1,
+		"_id":     0,
+	}
+
+	options := options.FindOne().SetProjection(projection)
+
+	var result UserLinks
+	if err := l.users().FindOne(ctx, filter, options).Decode(&result); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	link := result.Links[0]
+	link.Owner = result.Email
+
+	return &link, nil
+}
+
+func (l *LinkStore) legacyGetAll(ctx context.Context, email string) ([]Link, error) {
+	projection := bson.M{"email": 1, "links": 1, "_id": 0}
+	options := options.FindOne().SetProjection(projection)
+
+	var result UserLinks
+	if err := l.users().FindOne(ctx, bson.M{"email": email}, options).Decode(&result); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	for i := range result.Links {
+		result.Links[i].Owner = email
+	}
+
+	return result.Links, nil
+}
+
+func (l *LinkStore) legacyGetAllLinks(ctx context.Context) ([]Link, error) {
+	filter := bson.M{"links.0": bson.M{"$exists": true}}
+	projection := bson.M{"email": 1, "links": 1, "_id": 0}
+
+	cursor, err := l.users().Find(ctx, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	links := []Link{}
+	for cursor.Next(ctx) {
+		var result UserLinks
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+
+		for _, link := range result.Links {
+			link.Owner = result.Email
+			links = append(links, link)
+		}
+	}
+
+	return links, cursor.Err()
+}
+
+func (l *LinkStore) legacyDeleteBySlug(ctx context.Context, email string, slug string) error {
+	filter := bson.M{"email": email}
+	update := bson.M{
+		"$pull": bson.M{
+			"links": bson.M{
+				"slug": slug,
+			},
+		},
+	}
+
+	result, err := l.users().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.ModifiedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (l *LinkStore) legacyUpdateBySlug(ctx context.Context, email string, link *Link) error {
+	filter := bson.M{
+		"email":      email,
+		"links.slug": link.Slug,
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"links.$.original_url":  link.OriginalUrl,
+			"links.$.expired_date":  link.Expired_date,
+			"links.$.redirect_type": link.RedirectType,
+		},
+	}
+
+	result, err := l.users().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// legacyRename moves an embedded link into the links collection under the
+// slug and with the fields of link. The copy is inserted before the embedded
+// link is removed, so without a transaction a failure leaves the link twice
+// rather than losing it.
+func (l *LinkStore) legacyRename(ctx context.Context, email string, oldSlug string, link *Link) error {
+	legacy, err := l.legacyGetBySlug(ctx, oldSlug)
+	if err != nil {
+		return err
+	}
+
+	if legacy.Owner != email {
+		return ErrNotFound
+	}
+
+	renamed := *legacy
+	renamed.Slug = link.Slug
+	renamed.OriginalUrl = link.OriginalUrl
+	renamed.Expired_date = link.Expired_date
+	renamed.RedirectType = link.RedirectType
+
+	if _, err := l.links().InsertOne(ctx, renamed); err != nil {
+		return duplicateKeyError(err)
+	}
+
+	return l.legacyDeleteBySlug(ctx, email, oldSlug)
+}
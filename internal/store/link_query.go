@@ -0,0 +1,297 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type LinkStatus string
+
+const (
+	LinkStatusAll     LinkStatus = ""
+	LinkStatusActive  LinkStatus = "active"
+	LinkStatusExpired LinkStatus = "expired"
+)
+
+type LinkSort string
+
+const (
+	LinkSortCreatedAt   LinkSort = "created_at"
+	LinkSortExpiredDate LinkSort = "expired_date"
+	LinkSortClicks      LinkSort = "clicks"
+)
+
+// LinkQuery selects one page of the links of a user. Zero values mean no
+// filter, except Sort which defaults to LinkSortCreatedAt. Links that never
+// expire have a zero expiry date and sort before every other link.
+type LinkQuery struct {
+	Status        LinkStatus
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Search        string
+	Sort          LinkSort
+	Descending    bool
+	Limit         int
+	Cursor        string
+	Now           time.Time
+}
+
+// DefaultLinkLimit is the page size of a LinkQuery without a limit.
+const DefaultLinkLimit = 20
+
+type LinkPage struct {
+	Links      []Link
+	NextCursor string
+}
+
+// linkCursor points just past the last link of a page. Links are ordered by
+// the sort field and then by slug, which is unique, so ties never repeat or
+// skip a link between pages.
+type linkCursor struct {
+	Sort       LinkSort  `json:"o"`
+	Descending bool      `json:"d,omitempty"`
+	Time       time.Time `json:"t,omitempty"`
+	Clicks     int64     `json:"c,omitempty"`
+	Slug       string    `json:"s"`
+}
+
+func (q *LinkQuery) sortField() LinkSort {
+	if q.Sort == "" {
+		return LinkSortCreatedAt
+	}
+	return q.Sort
+}
+
+func (c *linkCursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// prepare fills in the defaults of q and decodes its cursor. It returns nil
+// for an empty cursor and ErrInvalidCursor for a cursor that is malformed or
+// was issued for a different sort order.
+func (q *LinkQuery) prepare() (*linkCursor, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultLinkLimit
+	}
+	if q.Now.IsZero() {
+		q.Now = time.Now()
+	}
+
+	if q.Cursor == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor linkCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.Slug == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	if cursor.Sort != q.sortField() || cursor.Descending != q.Descending {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+func (c *linkCursor) value() any {
+	if c.Sort == LinkSortClicks {
+		return c.Clicks
+	}
+	return c.Time
+}
+
+// List returns a page of the links of email. Links still embedded in the
+// user document can't be paged by the database, they are filtered here and
+// merged into the page.
+func (l *LinkStore) List(ctx context.Context, email string, query LinkQuery) (*LinkPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	cursor, err := query.prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	and := bson.A{bson.M{"owner": email}}
+
+	switch query.Status {
+	case LinkStatusActive:
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"expired_date": time.Time{}},
+			bson.M{"expired_date": bson.M{"$gte": query.Now}},
+		}})
+	case LinkStatusExpired:
+		and = append(and, bson.M{"expired_date": bson.M{"$gt": time.Time{}, "$lt": query.Now}})
+	}
+
+	if !query.CreatedAfter.IsZero() {
+		and = append(and, bson.M{"created_at": bson.M{"$gte": query.CreatedAfter}})
+	}
+	if !query.CreatedBefore.IsZero() {
+		and = append(and, bson.M{"created_at": bson.M{"$lt": query.CreatedBefore}})
+	}
+
+	if query.Search != "" {
+		pattern := bson.M{"$regex": regexp.QuoteMeta(query.Search), "$options": "i"}
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"slug": pattern},
+			bson.M{"original_url": pattern},
+		}})
+	}
+
+	field := string(query.sortField())
+
+	after, order := "$gt", 1
+	if query.Descending {
+		after, order = "$lt", -1
+	}
+
+	if cursor != nil {
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{field: bson.M{after: cursor.value()}},
+			bson.M{field: cursor.value(), "slug": bson.M{after: cursor.Slug}},
+		}})
+	}
+
+	options := options.Find().
+		SetSort(bson.D{{Key: field, Value: order}, {Key: "slug", Value: order}}).
+		SetLimit(int64(query.Limit + 1))
+
+	result, err := l.links().Find(ctx, bson.M{"$and": and}, options)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close(ctx)
+
+	links := []Link{}
+	if err := result.All(ctx, &links); err != nil {
+		return nil, err
+	}
+
+	legacy, err := l.legacyGetAll(ctx, email)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+
+	for i := range legacy {
+		if query.matches(&legacy[i]) && query.after(&legacy[i], cursor) {
+			links = append(links, legacy[i])
+		}
+	}
+
+	return newLinkPage(&query, links), nil
+}
+
+// newLinkPage sorts links, which hold at least every link of the page and the
+// one after it, in the order of query and trims them to a page. It sets the
+// cursor of the next page when there is one.
+func newLinkPage(query *LinkQuery, links []Link) *LinkPage {
+	sort.Slice(links, func(i, j int) bool {
+		return query.compare(query.cursorOf(&links[i]), query.cursorOf(&links[j])) < 0
+	})
+
+	page := &LinkPage{Links: links}
+
+	if len(links) > query.Limit {
+		page.Links = links[:query.Limit]
+		page.NextCursor = query.cursorOf(&page.Links[query.Limit-1]).encode()
+	}
+
+	return page
+}
+
+// matches reports whether link passes the filters of q, ignoring the owner
+// and the cursor.
+func (q *LinkQuery) matches(link *Link) bool {
+	switch q.Status {
+	case LinkStatusActive:
+		if link.IsExpired(q.Now) {
+			return false
+		}
+	case LinkStatusExpired:
+		if !link.IsExpired(q.Now) {
+			return false
+		}
+	}
+
+	if !q.CreatedAfter.IsZero() && link.Created_at.Before(q.CreatedAfter) {
+		return false
+	}
+	if !q.CreatedBefore.IsZero() && !link.Created_at.Before(q.CreatedBefore) {
+		return false
+	}
+
+	if q.Search != "" {
+		search := strings.ToLower(q.Search)
+		if !strings.Contains(strings.ToLower(link.Slug), search) && !strings.Contains(strings.ToLower(link.OriginalUrl), search) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// after reports whether link comes after cursor in the order of q. Every
+// link comes after a nil cursor.
+func (q *LinkQuery) after(link *Link, cursor *linkCursor) bool {
+	return cursor == nil || q.compare(q.cursorOf(link), cursor) > 0
+}
+
+// compare returns a negative number when a comes before b in the order of q,
+// a positive number when it comes after b and zero when they are equal.
+func (q *LinkQuery) compare(a, b *linkCursor) int {
+	var c int
+	switch q.sortField() {
+	case LinkSortClicks:
+		switch {
+		case a.Clicks < b.Clicks:
+			c = -1
+		case a.Clicks > b.Clicks:
+			c = 1
+		}
+	default:
+		c = a.Time.Compare(b.Time)
+	}
+
+	if c == 0 {
+		c = strings.Compare(a.Slug, b.Slug)
+	}
+
+	if q.Descending {
+		return -c
+	}
+	return c
+}
+
+// cursorOf returns the position of link in the order of q.
+func (q *LinkQuery) cursorOf(link *Link) *linkCursor {
+	cursor := &linkCursor{Sort: q.sortField(), Descending: q.Descending, Slug: link.Slug}
+
+	switch cursor.Sort {
+	case LinkSortCreatedAt:
+		cursor.Time = link.Created_at
+	case LinkSortExpiredDate:
+		cursor.Time = link.Expired_date
+	case LinkSortClicks:
+		cursor.Clicks = link.Clicks
+	}
+
+	return cursor
+}
@@ -0,0 +1,590 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryDB is the shared state behind the in-memory stores. Every kind of
+// record is kept separately, mirroring the Mongo collections.
+type memoryDB struct {
+	mu       sync.RWMutex
+	users    map[string]*User
+	order    []string
+	links    []*Link
+	clicks   []Click
+	sessions map[string]*Session
+	apiKeys  []*APIKey
+}
+
+type MemoryUserStore struct {
+	db *memoryDB
+}
+
+type MemoryLinkStore struct {
+	db *memoryDB
+}
+
+type MemoryClickStore struct {
+	db *memoryDB
+}
+
+type MemorySessionStore struct {
+	db *memoryDB
+}
+
+type MemoryAPIKeyStore struct {
+	db *memoryDB
+}
+
+type MemoryHealthStore struct{}
+
+func NewMemoryStorage() Storage {
+	db := &memoryDB{
+		users:    make(map[string]*User),
+		sessions: make(map[string]*Session),
+	}
+
+	return Storage{
+		Users:    &MemoryUserStore{db},
+		Links:    &MemoryLinkStore{db},
+		Clicks:   &MemoryClickStore{db},
+		Sessions: &MemorySessionStore{db},
+		APIKeys:  &MemoryAPIKeyStore{db},
+		Health:   &MemoryHealthStore{},
+	}
+}
+
+func copyUser(u *User) User {
+	user := *u
+	user.Password = append([]byte(nil), u.Password...)
+	return user
+}
+
+func (s *MemoryUserStore) Create(ctx context.Context, user *User) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.users[user.Email]; ok {
+		return ErrDuplicateEmail
+	}
+
+	if user.Username != "" {
+		for _, u := range s.db.users {
+			if u.Username == user.Username {
+				return ErrDuplicateUsername
+			}
+		}
+	}
+
+	stored := copyUser(user)
+	s.db.users[user.Email] = &stored
+	s.db.order = append(s.db.order, user.Email)
+
+	return nil
+}
+
+func (s *MemoryUserStore) Update(ctx context.Context, user *User) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	stored, ok := s.db.users[user.Email]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if user.Username != "" {
+		for email, u := range s.db.users {
+			if email != user.Email && u.Username == user.Username {
+				return ErrDuplicateUsername
+			}
+		}
+	}
+
+	stored.Username = user.Username
+
+	return nil
+}
+
+func (s *MemoryUserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	stored, ok := s.db.users[email]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	user := copyUser(stored)
+	return &user, nil
+}
+
+func (s *MemoryUserStore) DeleteByEmail(ctx context.Context, email string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.users[email]; !ok {
+		return ErrNotFound
+	}
+
+	delete(s.db.users, email)
+	for i, e := range s.db.order {
+		if e == email {
+			s.db.order = append(s.db.order[:i], s.db.order[i+1:]...)
+			break
+		}
+	}
+
+	links := s.db.links[:0]
+	for _, link := range s.db.links {
+		if link.Owner != email {
+			links = append(links, link)
+		}
+	}
+	s.db.links = links
+
+	s.db.deleteClicks(email, "")
+
+	keys := s.db.apiKeys[:0]
+	for _, key := range s.db.apiKeys {
+		if key.Owner != email {
+			keys = append(keys, key)
+		}
+	}
+	s.db.apiKeys = keys
+
+	for id, session := range s.db.sessions {
+		if session.Email == email {
+			delete(s.db.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryUserStore) GetAllUsers(ctx context.Context) ([]User, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	users := []User{}
+	for _, email := range s.db.order {
+		users = append(users, copyUser(s.db.users[email]))
+	}
+
+	return users, nil
+}
+
+func (s *MemoryUserStore) SetRole(ctx context.Context, email string, role string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	stored, ok := s.db.users[email]
+	if !ok {
+		return ErrNotFound
+	}
+
+	stored.Role = role
+	return nil
+}
+
+func (s *MemoryUserStore) SetSuspended(ctx context.Context, email string, suspended bool) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	stored, ok := s.db.users[email]
+	if !ok {
+		return ErrNotFound
+	}
+
+	stored.Suspended = suspended
+	return nil
+}
+
+// find returns the index of the link with the given slug, or -1. An empty
+// owner matches any owner. Callers must hold the lock.
+func (l *MemoryLinkStore) find(owner, slug string) int {
+	for i, link := range l.db.links {
+		if link.Slug == slug && (owner == "" || link.Owner == owner) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (l *MemoryLinkStore) Create(ctx context.Context, email string, link *Link) error {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	if _, ok := l.db.users[email]; !ok {
+		return ErrNotFound
+	}
+
+	if l.find("", link.Slug) >= 0 {
+		return ErrDuplicateSlug
+	}
+
+	link.Owner = email
+
+	stored := *link
+	l.db.links = append(l.db.links, &stored)
+
+	return nil
+}
+
+func (l *MemoryLinkStore) GetBySlug(ctx context.Context, slug string) (*Link, error) {
+	l.db.mu.RLock()
+	defer l.db.mu.RUnlock()
+
+	i := l.find("", slug)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+
+	link := *l.db.links[i]
+	return &link, nil
+}
+
+func (l *MemoryLinkStore) GetAll(ctx context.Context, email string) ([]Link, error) {
+	l.db.mu.RLock()
+	defer l.db.mu.RUnlock()
+
+	if _, ok := l.db.users[email]; !ok {
+		return nil, ErrNotFound
+	}
+
+	links := []Link{}
+	for _, link := range l.db.links {
+		if link.Owner == email {
+			links = append(links, *link)
+		}
+	}
+
+	return links, nil
+}
+
+func (l *MemoryLinkStore) List(ctx context.Context, email string, query LinkQuery) (*LinkPage, error) {
+	cursor, err := query.prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	l.db.mu.RLock()
+	defer l.db.mu.RUnlock()
+
+	links := []Link{}
+	for _, link := range l.db.links {
+		if link.Owner == email && query.matches(link) && query.after(link, cursor) {
+			links = append(links, *link)
+		}
+	}
+
+	return newLinkPage(&query, links), nil
+}
+
+func (l *MemoryLinkStore) GetAllLinks(ctx context.Context) ([]Link, error) {
+	l.db.mu.RLock()
+	defer l.db.mu.RUnlock()
+
+	links := []Link{}
+	for _, link := range l.db.links {
+		links = append(links, *link)
+	}
+
+	return links, nil
+}
+
+func (l *MemoryLinkStore) DeleteBySlug(ctx context.Context, email string, slug string) error {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	i := l.find(email, slug)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	links := l.db.links[:0]
+	for j, link := range l.db.links {
+		if j != i && (link.Owner != email || link.AliasOf != slug) {
+			links = append(links, link)
+		}
+	}
+	l.db.links = links
+	l.db.deleteClicks(email, slug)
+
+	return nil
+}
+
+func (l *MemoryLinkStore) UpdateBySlug(ctx context.Context, email string, link *Link) error {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	i := l.find(email, link.Slug)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	l.db.links[i].OriginalUrl = link.OriginalUrl
+	l.db.links[i].Expired_date = link.Expired_date
+	l.db.links[i].RedirectType = link.RedirectType
+
+	return nil
+}
+
+// Rename moves the link of email from oldSlug to link.Slug and writes the
+// other fields of link, see LinkStore.Rename.
+func (l *MemoryLinkStore) Rename(ctx context.Context, email string, oldSlug string, link *Link, keepAlias bool) error {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	i := l.find(email, oldSlug)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	newSlug := link.Slug
+	if l.find("", newSlug) >= 0 {
+		return ErrDuplicateSlug
+	}
+
+	renamed := l.db.links[i]
+	renamed.Slug = newSlug
+	renamed.OriginalUrl = link.OriginalUrl
+	renamed.Expired_date = link.Expired_date
+	renamed.RedirectType = link.RedirectType
+
+	for _, alias := range l.db.links {
+		if alias.Owner == email && alias.AliasOf == oldSlug {
+			alias.AliasOf = newSlug
+		}
+	}
+
+	for i := range l.db.clicks {
+		if l.db.clicks[i].Owner == email && l.db.clicks[i].Slug == oldSlug {
+			l.db.clicks[i].Slug = newSlug
+		}
+	}
+
+	if keepAlias {
+		l.db.links = append(l.db.links, aliasOf(renamed, oldSlug))
+	}
+
+	return nil
+}
+
+// deleteClicks removes the clicks of owner, limited to slug unless it is
+// empty. Callers must hold the lock.
+func (db *memoryDB) deleteClicks(owner, slug string) {
+	clicks := db.clicks[:0]
+	for _, click := range db.clicks {
+		if click.Owner != owner || slug != "" && click.Slug != slug {
+			clicks = append(clicks, click)
+		}
+	}
+	db.clicks = clicks
+}
+
+func (c *MemoryClickStore) CreateMany(ctx context.Context, clicks []Click) error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	c.db.clicks = append(c.db.clicks, clicks...)
+
+	for key, count := range countClicks(clicks) {
+		for _, link := range c.db.links {
+			if link.Owner == key.owner && link.Slug == key.slug {
+				link.Clicks += count
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *MemoryClickStore) Count(ctx context.Context, email string, slug string) (int64, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	var count int64
+	for _, click := range c.db.clicks {
+		if click.Owner == email && click.Slug == slug {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (c *MemoryClickStore) Series(ctx context.Context, email string, slug string, interval ClickInterval, since time.Time) ([]ClickBucket, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	since = truncate(since, interval)
+
+	counts := make(map[time.Time]int64)
+	for _, click := range c.db.clicks {
+		if click.Owner == email && click.Slug == slug && !click.Timestamp.Before(since) {
+			counts[truncate(click.Timestamp, interval)]++
+		}
+	}
+
+	return fillBuckets(counts, interval, since, time.Now()), nil
+}
+
+func copySession(s *Session) *Session {
+	session := *s
+	session.PreviousHashes = append([]string{}, s.PreviousHashes...)
+	return &session
+}
+
+func (s *MemorySessionStore) Create(ctx context.Context, session *Session) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.sessions[session.ID] = copySession(session)
+
+	return nil
+}
+
+func (s *MemorySessionStore) GetByID(ctx context.Context, id string) (*Session, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	session, ok := s.db.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return copySession(session), nil
+}
+
+func (s *MemorySessionStore) GetByTokenHash(ctx context.Context, hash string) (*Session, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	for _, session := range s.db.sessions {
+		if session.TokenHash == hash {
+			return copySession(session), nil
+		}
+
+		for _, previous := range session.PreviousHashes {
+			if previous == hash {
+				return copySession(session), nil
+			}
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (s *MemorySessionStore) Rotate(ctx context.Context, id string, oldHash string, newHash string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	session, ok := s.db.sessions[id]
+	if !ok || session.Revoked || session.TokenHash != oldHash {
+		return ErrNotFound
+	}
+
+	session.PreviousHashes = append(session.PreviousHashes, oldHash)
+	if n := len(session.PreviousHashes); n > MaxPreviousHashes {
+		session.PreviousHashes = session.PreviousHashes[n-MaxPreviousHashes:]
+	}
+	session.TokenHash = newHash
+
+	return nil
+}
+
+func (s *MemorySessionStore) Revoke(ctx context.Context, id string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	session, ok := s.db.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	session.Revoked = true
+
+	return nil
+}
+
+func copyAPIKey(k *APIKey) APIKey {
+	key := *k
+	key.Scopes = append([]string{}, k.Scopes...)
+	return key
+}
+
+func (s *MemoryAPIKeyStore) Create(ctx context.Context, key *APIKey) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	stored := copyAPIKey(key)
+	s.db.apiKeys = append(s.db.apiKeys, &stored)
+
+	return nil
+}
+
+func (s *MemoryAPIKeyStore) GetByHash(ctx context.Context, hash string) (*APIKey, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	for _, key := range s.db.apiKeys {
+		if key.Hash == hash {
+			found := copyAPIKey(key)
+			return &found, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (s *MemoryAPIKeyStore) GetAll(ctx context.Context, email string) ([]APIKey, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	keys := []APIKey{}
+	for _, key := range s.db.apiKeys {
+		if key.Owner == email {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+
+	return keys, nil
+}
+
+func (s *MemoryAPIKeyStore) Revoke(ctx context.Context, email string, id string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, key := range s.db.apiKeys {
+		if key.ID == id && key.Owner == email {
+			key.Revoked = true
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *MemoryAPIKeyStore) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, key := range s.db.apiKeys {
+		if key.ID == id {
+			if at.After(key.LastUsed_at) {
+				key.LastUsed_at = at
+			}
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// Ping only fails when ctx is done, there is nothing to reach.
+func (h *MemoryHealthStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MigrationResult struct {
+	Users     int
+	Moved     int
+	Conflicts []Link
+}
+
+// MigrateEmbeddedLinks copies links embedded in user documents into the links
+// collection and removes them from the user afterwards. It is safe to run
+// while the API is serving traffic and to run again after a partial failure:
+// a link already present for the same owner is treated as moved, and a slug
+// claimed by another owner is left embedded and reported as a conflict.
+func MigrateEmbeddedLinks(ctx context.Context, db *mongo.Client, dryRun bool) (*MigrationResult, error) {
+	users := db.Database(DB).Collection(Collection)
+	links := db.Database(DB).Collection(LinkCollection)
+
+	filter := bson.M{"links.0": bson.M{"$exists": true}}
+	projection := bson.M{"email": 1, "links": 1, "_id": 0}
+
+	cursor, err := users.Find(ctx, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	result := &MigrationResult{}
+
+	for cursor.Next(ctx) {
+		var user UserLinks
+		if err := cursor.Decode(&user); err != nil {
+			return result, err
+		}
+
+		result.Users++
+
+		var moved []string
+		for _, link := range user.Links {
+			link.Owner = user.Email
+
+			if dryRun {
+				moved = append(moved, link.Slug)
+				continue
+			}
+
+			_, err := links.InsertOne(ctx, link)
+			if err != nil && !mongo.IsDuplicateKeyError(err) {
+				return result, err
+			}
+
+			if err != nil {
+				var existing Link
+				if err := links.FindOne(ctx, bson.M{"slug": link.Slug}).Decode(&existing); err != nil {
+					return result, err
+				}
+
+				if existing.Owner != user.Email {
+					result.Conflicts = append(result.Conflicts, link)
+					continue
+				}
+			}
+
+			moved = append(moved, link.Slug)
+		}
+
+		result.Moved += len(moved)
+
+		if dryRun || len(moved) == 0 {
+			continue
+		}
+
+		update := bson.M{
+			"$pull": bson.M{
+				"links": bson.M{
+					"slug": bson.M{"$in": moved},
+				},
+			},
+		}
+
+		if _, err := users.UpdateOne(ctx, bson.M{"email": user.Email}, update); err != nil {
+			return result, err
+		}
+	}
+
+	return result, cursor.Err()
+}
+
+// BackfillClickCounts sets the click counter of every link to the number of
+// clicks recorded for it. Links created before the counter existed have no
+// counter and would otherwise be skipped when paging links sorted by clicks.
+// Clicks recorded while it runs may be counted twice or not at all, so run it
+// before the API starts serving traffic.
+func BackfillClickCounts(ctx context.Context, db *mongo.Client) (int, error) {
+	links := db.Database(DB).Collection(LinkCollection)
+	clicks := db.Database(DB).Collection(ClickCollection)
+
+	if _, err := links.UpdateMany(ctx, bson.M{"clicks": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"clicks": 0}}); err != nil {
+		return 0, err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"owner": "$owner", "slug": "$slug"},
+			"count": bson.M{"$sum": 1},
+		}}},
+	}
+
+	cursor, err := clicks.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	updated := 0
+	for cursor.Next(ctx) {
+		var total struct {
+			ID struct {
+				Owner string `bson:"owner"`
+				Slug  string `bson:"slug"`
+			} `bson:"_id"`
+			Count int64 `bson:"count"`
+		}
+		if err := cursor.Decode(&total); err != nil {
+			return updated, err
+		}
+
+		filter := bson.M{"owner": total.ID.Owner, "slug": total.ID.Slug}
+		result, err := links.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"clicks": total.Count}})
+		if err != nil {
+			return updated, err
+		}
+		updated += int(result.ModifiedCount)
+	}
+
+	return updated, cursor.Err()
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Session is a login that can be kept alive with refresh tokens. Only the
+// hash of the current refresh token is stored, together with the hashes of
+// tokens it replaced so that reuse of a rotated token can be detected.
+type Session struct {
+	ID             string    `bson:"_id" json:"id"`
+	Email          string    `bson:"email" json:"email"`
+	TokenHash      string    `bson:"token_hash" json:"-"`
+	PreviousHashes []string  `bson:"previous_hashes" json:"-"`
+	Created_at     time.Time `bson:"created_at" json:"created_at"`
+	Expired_date   time.Time `bson:"expired_date" json:"expired_date"`
+	Revoked        bool      `bson:"revoked" json:"revoked"`
+}
+
+// MaxPreviousHashes is how many rotated refresh tokens a session remembers.
+// Reuse of an older token is rejected like any unknown token, but no longer
+// revokes the session.
+const MaxPreviousHashes = 20
+
+func (s *Session) IsActive(now time.Time) bool {
+	return !s.Revoked && s.Expired_date.After(now)
+}
+
+type SessionStore struct {
+	db *mongo.Client
+}
+
+func (s *SessionStore) sessions() *mongo.Collection {
+	return s.db.Database(DB).Collection(SessionCollection)
+}
+
+func (s *SessionStore) Create(ctx context.Context, session *Session) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if session.PreviousHashes == nil {
+		session.PreviousHashes = []string{}
+	}
+
+	_, err := s.sessions().InsertOne(ctx, session)
+	return err
+}
+
+func (s *SessionStore) GetByID(ctx context.Context, id string) (*Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.findOne(ctx, bson.M{"_id": id})
+}
+
+// GetByTokenHash finds the session a refresh token belongs to, whether the
+// token is the current one or has already been rotated.
+func (s *SessionStore) GetByTokenHash(ctx context.Context, hash string) (*Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"token_hash": hash},
+			bson.M{"previous_hashes": hash},
+		},
+	}
+
+	return s.findOne(ctx, filter)
+}
+
+func (s *SessionStore) findOne(ctx context.Context, filter bson.M) (*Session, error) {
+	var session Session
+	if err := s.sessions().FindOne(ctx, filter).Decode(&session); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// Rotate replaces the current refresh token of a session. It fails with
+// ErrNotFound when oldHash is no longer the current token or the session has
+// been revoked, so only one of two concurrent rotations can win.
+func (s *SessionStore) Rotate(ctx context.Context, id string, oldHash string, newHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":        id,
+		"token_hash": oldHash,
+		"revoked":    false,
+	}
+
+	update := bson.M{
+		"$set":  bson.M{"token_hash": newHash},
+		"$push": bson.M{"previous_hashes": bson.M{"$each": bson.A{oldHash}, "$slice": -MaxPreviousHashes}},
+	}
+
+	result, err := s.sessions().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *SessionStore) Revoke(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.sessions().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -11,6 +11,10 @@ import (
 var (
 	DB                   = "link-shortener"
 	Collection           = "data"
+	LinkCollection       = "links"
+	ClickCollection      = "clicks"
+	SessionCollection    = "sessions"
+	APIKeyCollection     = "api_keys"
 	ErrDuplicateEmail    = errors.New("email already exists")
 	ErrDuplicateUsername = errors.New("username already exists")
 	ErrNotFound          = errors.New("user not found")
@@ -25,21 +29,56 @@ type Storage struct {
 		Update(ctx context.Context, user *User) error
 		GetByEmail(ctx context.Context, email string) (*User, error)
 		DeleteByEmail(ctx context.Context, email string) error 
+		SetRole(ctx context.Context, email string, role string) error
+		SetSuspended(ctx context.Context, email string, suspended bool) error
 	}
 
 	Links interface {
 		Create(ctx context.Context, email string, link *Link) error
 		GetBySlug(ctx context.Context, slug string) (*Link, error)
 		GetAll(ctx context.Context, email string) ([]Link, error)
+		List(ctx context.Context, email string, query LinkQuery) (*LinkPage, error)
+		GetAllLinks(ctx context.Context) ([]Link, error)
 		DeleteBySlug(ctx context.Context, email string, slug string) error
 		UpdateBySlug(ctx context.Context, email string, link *Link) error
+		Rename(ctx context.Context, email string, oldSlug string, link *Link, keepAlias bool) error
+	}
+
+	Clicks interface {
+		CreateMany(ctx context.Context, clicks []Click) error
+		Count(ctx context.Context, email string, slug string) (int64, error)
+		Series(ctx context.Context, email string, slug string, interval ClickInterval, since time.Time) ([]ClickBucket, error)
+	}
+
+	Sessions interface {
+		Create(ctx context.Context, session *Session) error
+		GetByID(ctx context.Context, id string) (*Session, error)
+		GetByTokenHash(ctx context.Context, hash string) (*Session, error)
+		Rotate(ctx context.Context, id string, oldHash string, newHash string) error
+		Revoke(ctx context.Context, id string) error
+	}
+
+	APIKeys interface {
+		Create(ctx context.Context, key *APIKey) error
+		GetByHash(ctx context.Context, hash string) (*APIKey, error)
+		GetAll(ctx context.Context, email string) ([]APIKey, error)
+		Revoke(ctx context.Context, email string, id string) error
+		TouchLastUsed(ctx context.Context, id string, at time.Time) error
+	}
+
+	Health interface {
+		Ping(ctx context.Context) error
 	}
 }
 
 func NewStorage(db *mongo.Client) Storage {
 	return Storage{
-		Users: &UserStore{db},
-		Links: &LinkStore{db},
+		Users:    &UserStore{db},
+		Links:    &LinkStore{db},
+		Clicks:   &ClickStore{db},
+		Sessions: &SessionStore{db},
+		APIKeys:  &APIKeyStore{db},
+		Health:   &HealthStore{db},
 	}
 }
 
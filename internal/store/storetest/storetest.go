@@ -0,0 +1,1181 @@
+// Package storetest provides a conformance suite that any store.Storage
+// backend can be run against.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devaartana/e01-oprec-rpl/internal/store"
+)
+
+// Run exercises the contracts of every store in store.Storage. newStorage is
+// called once per subtest and must return an empty storage.
+func Run(t *testing.T, newStorage func(t *testing.T) store.Storage) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.Storage)
+	}{
+		{"UserCreateAndGet", testUserCreateAndGet},
+		{"UserDuplicateEmail", testUserDuplicateEmail},
+		{"UserDuplicateUsername", testUserDuplicateUsername},
+		{"UserConcurrentCreate", testUserConcurrentCreate},
+		{"UserNotFound", testUserNotFound},
+		{"UserUpdate", testUserUpdate},
+		{"UserDelete", testUserDelete},
+		{"UserDeleteRemovesLinks", testUserDeleteRemovesLinks},
+		{"UserDeleteRemovesSessions", testUserDeleteRemovesSessions},
+		{"UserGetAll", testUserGetAll},
+		{"UserRoleAndSuspend", testUserRoleAndSuspend},
+		{"LinkCreateAndGet", testLinkCreateAndGet},
+		{"LinkDuplicateSlug", testLinkDuplicateSlug},
+		{"LinkConcurrentCreate", testLinkConcurrentCreate},
+		{"LinkCreateUnknownUser", testLinkCreateUnknownUser},
+		{"LinkNotFound", testLinkNotFound},
+		{"LinkGetAll", testLinkGetAll},
+		{"LinkGetAllLinks", testLinkGetAllLinks},
+		{"LinkListPages", testLinkListPages},
+		{"LinkListFilters", testLinkListFilters},
+		{"LinkListSortByClicks", testLinkListSortByClicks},
+		{"LinkListInvalidCursor", testLinkListInvalidCursor},
+		{"LinkDelete", testLinkDelete},
+		{"LinkDeleteOtherUser", testLinkDeleteOtherUser},
+		{"LinkUpdate", testLinkUpdate},
+		{"LinkUpdateNotFound", testLinkUpdateNotFound},
+		{"LinkNeverExpires", testLinkNeverExpires},
+		{"LinkRename", testLinkRename},
+		{"LinkRenameConflict", testLinkRenameConflict},
+		{"LinkRenameKeepAlias", testLinkRenameKeepAlias},
+		{"LinkDeleteRemovesAliases", testLinkDeleteRemovesAliases},
+		{"ClickCount", testClickCount},
+		{"ClickSeries", testClickSeries},
+		{"ClickDeletedWithLink", testClickDeletedWithLink},
+		{"SessionCreateAndGet", testSessionCreateAndGet},
+		{"SessionRotate", testSessionRotate},
+		{"SessionRotateCapsHistory", testSessionRotateCapsHistory},
+		{"SessionRevoke", testSessionRevoke},
+		{"APIKeyLifecycle", testAPIKeyLifecycle},
+		{"APIKeyDeletedWithUser", testAPIKeyDeletedWithUser},
+		{"HealthPing", testHealthPing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStorage(t))
+		})
+	}
+}
+
+// now is truncated to milliseconds, the precision Mongo stores dates with.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+func newUser(email string) *store.User {
+	user := &store.User{
+		Username:   email,
+		Email:      email,
+		Created_at: now(),
+	}
+	user.SetPassword("password123")
+
+	return user
+}
+
+func newLink(slug string) *store.Link {
+	return &store.Link{
+		Slug:         slug,
+		OriginalUrl:  "https://example.com/" + slug,
+		Created_at:   now(),
+		Expired_date: now().Add(30 * 24 * time.Hour),
+		RedirectType: 302,
+	}
+}
+
+func mustCreateUser(t *testing.T, s store.Storage, email string) *store.User {
+	t.Helper()
+
+	user := newUser(email)
+	if err := s.Users.Create(context.Background(), user); err != nil {
+		t.Fatalf("Users.Create(%q): %v", email, err)
+	}
+
+	return user
+}
+
+func mustCreateLink(t *testing.T, s store.Storage, email, slug string) *store.Link {
+	t.Helper()
+
+	link := newLink(slug)
+	if err := s.Links.Create(context.Background(), email, link); err != nil {
+		t.Fatalf("Links.Create(%q, %q): %v", email, slug, err)
+	}
+
+	return link
+}
+
+// concurrently runs fn n times in parallel and returns every result.
+func concurrently(n int, fn func(i int) error) []error {
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+func wantErr(t *testing.T, op string, got, want error) {
+	t.Helper()
+
+	if !errors.Is(got, want) {
+		t.Fatalf("%s: got error %v, want %v", op, got, want)
+	}
+}
+
+func equalLink(t *testing.T, got, want *store.Link) {
+	t.Helper()
+
+	if got.Slug != want.Slug || got.OriginalUrl != want.OriginalUrl {
+		t.Fatalf("got link %q -> %q, want %q -> %q", got.Slug, got.OriginalUrl, want.Slug, want.OriginalUrl)
+	}
+	if !got.Created_at.Equal(want.Created_at) {
+		t.Fatalf("link %q: got created_at %v, want %v", want.Slug, got.Created_at, want.Created_at)
+	}
+	if !got.Expired_date.Equal(want.Expired_date) {
+		t.Fatalf("link %q: got expired_date %v, want %v", want.Slug, got.Expired_date, want.Expired_date)
+	}
+	if got.RedirectType != want.RedirectType {
+		t.Fatalf("link %q: got redirect_type %d, want %d", want.Slug, got.RedirectType, want.RedirectType)
+	}
+}
+
+func testUserCreateAndGet(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	want := mustCreateUser(t, s, "alice@example.com")
+
+	got, err := s.Users.GetByEmail(ctx, want.Email)
+	if err != nil {
+		t.Fatalf("Users.GetByEmail: %v", err)
+	}
+
+	if got.Email != want.Email || got.Username != want.Username {
+		t.Fatalf("got user %q/%q, want %q/%q", got.Email, got.Username, want.Email, want.Username)
+	}
+	if !got.Created_at.Equal(want.Created_at) {
+		t.Fatalf("got created_at %v, want %v", got.Created_at, want.Created_at)
+	}
+	if err := got.Compare("password123"); err != nil {
+		t.Fatalf("stored password does not match: %v", err)
+	}
+}
+
+func testUserDuplicateEmail(t *testing.T, s store.Storage) {
+	mustCreateUser(t, s, "alice@example.com")
+
+	err := s.Users.Create(context.Background(), newUser("alice@example.com"))
+	wantErr(t, "Users.Create duplicate", err, store.ErrDuplicateEmail)
+}
+
+func testUserDuplicateUsername(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+
+	user := newUser("other@example.com")
+	user.Username = "alice@example.com"
+	err := s.Users.Create(ctx, user)
+	wantErr(t, "Users.Create duplicate username", err, store.ErrDuplicateUsername)
+
+	bob := mustCreateUser(t, s, "bob@example.com")
+	bob.Username = "alice@example.com"
+	err = s.Users.Update(ctx, bob)
+	wantErr(t, "Users.Update duplicate username", err, store.ErrDuplicateUsername)
+}
+
+func testUserConcurrentCreate(t *testing.T, s store.Storage) {
+	errs := concurrently(10, func(i int) error {
+		user := newUser("alice@example.com")
+		user.Username = fmt.Sprintf("alice-%d", i)
+		return s.Users.Create(context.Background(), user)
+	})
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, store.ErrDuplicateEmail):
+			t.Fatalf("Users.Create: got error %v, want %v", err, store.ErrDuplicateEmail)
+		}
+	}
+
+	if created != 1 {
+		t.Fatalf("%d concurrent registrations succeeded, want 1", created)
+	}
+}
+
+func testUserNotFound(t *testing.T, s store.Storage) {
+	_, err := s.Users.GetByEmail(context.Background(), "nobody@example.com")
+	wantErr(t, "Users.GetByEmail", err, store.ErrNotFound)
+}
+
+func testUserUpdate(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "alice@example.com")
+
+	user.Username = "alice"
+	if err := s.Users.Update(ctx, user); err != nil {
+		t.Fatalf("Users.Update: %v", err)
+	}
+
+	got, err := s.Users.GetByEmail(ctx, user.Email)
+	if err != nil {
+		t.Fatalf("Users.GetByEmail: %v", err)
+	}
+	if got.Username != "alice" {
+		t.Fatalf("got username %q, want %q", got.Username, "alice")
+	}
+
+	err = s.Users.Update(ctx, newUser("nobody@example.com"))
+	wantErr(t, "Users.Update unknown user", err, store.ErrNotFound)
+}
+
+func testUserDelete(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "alice@example.com")
+
+	if err := s.Users.DeleteByEmail(ctx, user.Email); err != nil {
+		t.Fatalf("Users.DeleteByEmail: %v", err)
+	}
+
+	_, err := s.Users.GetByEmail(ctx, user.Email)
+	wantErr(t, "Users.GetByEmail after delete", err, store.ErrNotFound)
+
+	err = s.Users.DeleteByEmail(ctx, user.Email)
+	wantErr(t, "Users.DeleteByEmail twice", err, store.ErrNotFound)
+}
+
+func testUserDeleteRemovesLinks(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateLink(t, s, "alice@example.com", "abc123")
+
+	if err := s.Users.DeleteByEmail(ctx, "alice@example.com"); err != nil {
+		t.Fatalf("Users.DeleteByEmail: %v", err)
+	}
+
+	_, err := s.Links.GetBySlug(ctx, "abc123")
+	wantErr(t, "Links.GetBySlug after owner delete", err, store.ErrNotFound)
+}
+
+func testUserDeleteRemovesSessions(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateSession(t, s, "session-1", "hash-1")
+
+	if err := s.Users.DeleteByEmail(ctx, "alice@example.com"); err != nil {
+		t.Fatalf("Users.DeleteByEmail: %v", err)
+	}
+
+	_, err := s.Sessions.GetByID(ctx, "session-1")
+	wantErr(t, "Sessions.GetByID after owner delete", err, store.ErrNotFound)
+
+	_, err = s.Sessions.GetByTokenHash(ctx, "hash-1")
+	wantErr(t, "Sessions.GetByTokenHash after owner delete", err, store.ErrNotFound)
+}
+
+func testUserGetAll(t *testing.T, s store.Storage) {
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateUser(t, s, "bob@example.com")
+
+	users, err := s.Users.GetAllUsers(context.Background())
+	if err != nil {
+		t.Fatalf("Users.GetAllUsers: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, u := range users {
+		seen[u.Email] = true
+	}
+	if len(users) != 2 || !seen["alice@example.com"] || !seen["bob@example.com"] {
+		t.Fatalf("got %d users %v, want alice and bob", len(users), seen)
+	}
+}
+
+func testUserRoleAndSuspend(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+
+	user, err := s.Users.GetByEmail(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatalf("Users.GetByEmail: %v", err)
+	}
+	if !user.HasRole(store.RoleUser) || user.HasRole(store.RoleAdmin) || user.Suspended {
+		t.Fatalf("new user has role %q, suspended %v", user.Role, user.Suspended)
+	}
+
+	if err := s.Users.SetRole(ctx, "alice@example.com", store.RoleAdmin); err != nil {
+		t.Fatalf("Users.SetRole: %v", err)
+	}
+	if err := s.Users.SetSuspended(ctx, "alice@example.com", true); err != nil {
+		t.Fatalf("Users.SetSuspended: %v", err)
+	}
+
+	user, err = s.Users.GetByEmail(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatalf("Users.GetByEmail: %v", err)
+	}
+	if !user.HasRole(store.RoleAdmin) || !user.Suspended {
+		t.Fatalf("got role %q, suspended %v, want admin and suspended", user.Role, user.Suspended)
+	}
+
+	err = s.Users.SetRole(ctx, "nobody@example.com", store.RoleAdmin)
+	wantErr(t, "Users.SetRole unknown user", err, store.ErrNotFound)
+
+	err = s.Users.SetSuspended(ctx, "nobody@example.com", true)
+	wantErr(t, "Users.SetSuspended unknown user", err, store.ErrNotFound)
+}
+
+func testLinkCreateAndGet(t *testing.T, s store.Storage) {
+	mustCreateUser(t, s, "alice@example.com")
+	want := mustCreateLink(t, s, "alice@example.com", "abc123")
+
+	got, err := s.Links.GetBySlug(context.Background(), "abc123")
+	if err != nil {
+		t.Fatalf("Links.GetBySlug: %v", err)
+	}
+
+	equalLink(t, got, want)
+	if got.Owner != "alice@example.com" {
+		t.Fatalf("got owner %q, want %q", got.Owner, "alice@example.com")
+	}
+}
+
+func testLinkDuplicateSlug(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateUser(t, s, "bob@example.com")
+	mustCreateLink(t, s, "alice@example.com", "abc123")
+
+	err := s.Links.Create(ctx, "alice@example.com", newLink("abc123"))
+	wantErr(t, "Links.Create same user", err, store.ErrDuplicateSlug)
+
+	err = s.Links.Create(ctx, "bob@example.com", newLink("abc123"))
+	wantErr(t, "Links.Create other user", err, store.ErrDuplicateSlug)
+}
+
+func testLinkConcurrentCreate(t *testing.T, s store.Storage) {
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateUser(t, s, "bob@example.com")
+
+	errs := concurrently(10, func(i int) error {
+		email := "alice@example.com"
+		if i%2 == 1 {
+			email = "bob@example.com"
+		}
+		return s.Links.Create(context.Background(), email, newLink("abc123"))
+	})
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, store.ErrDuplicateSlug):
+			t.Fatalf("Links.Create: got error %v, want %v", err, store.ErrDuplicateSlug)
+		}
+	}
+
+	if created != 1 {
+		t.Fatalf("%d concurrent creations of the same slug succeeded, want 1", created)
+	}
+}
+
+func testLinkCreateUnknownUser(t *testing.T, s store.Storage) {
+	err := s.Links.Create(context.Background(), "nobody@example.com", newLink("abc123"))
+	wantErr(t, "Links.Create unknown user", err, store.ErrNotFound)
+}
+
+func testLinkNotFound(t *testing.T, s store.Storage) {
+	_, err := s.Links.GetBySlug(context.Background(), "missing")
+	wantErr(t, "Links.GetBySlug", err, store.ErrNotFound)
+}
+
+func testLinkGetAll(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateUser(t, s, "bob@example.com")
+
+	links, err := s.Links.GetAll(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatalf("Links.GetAll empty: %v", err)
+	}
+	if len(links) != 0 {
+		t.Fatalf("got %d links for new user, want 0", len(links))
+	}
+
+	first := mustCreateLink(t, s, "alice@example.com", "first")
+	second := mustCreateLink(t, s, "alice@example.com", "second")
+	mustCreateLink(t, s, "bob@example.com", "other")
+
+	links, err = s.Links.GetAll(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatalf("Links.GetAll: %v", err)
+	}
+	if len(links) != 2 {
+		t.Fatalf("got %d links, want 2", len(links))
+	}
+	equalLink(t, &links[0], first)
+	equalLink(t, &links[1], second)
+
+	_, err = s.Links.GetAll(ctx, "nobody@example.com")
+	wantErr(t, "Links.GetAll unknown user", err, store.ErrNotFound)
+}
+
+// listSlugs pages through the links of email with query and returns their
+// slugs in order.
+func listSlugs(t *testing.T, s store.Storage, email string, query store.LinkQuery) []string {
+	t.Helper()
+
+	slugs := []string{}
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("Links.List: too many pages")
+		}
+
+		page, err := s.Links.List(context.Background(), email, query)
+		if err != nil {
+			t.Fatalf("Links.List: %v", err)
+		}
+		if len(page.Links) > query.Limit {
+			t.Fatalf("Links.List: got %d links, want at most %d", len(page.Links), query.Limit)
+		}
+
+		for _, link := range page.Links {
+			slugs = append(slugs, link.Slug)
+		}
+
+		if page.NextCursor == "" {
+			return slugs
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+func wantSlugs(t *testing.T, op string, got []string, want ...string) {
+	t.Helper()
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("%s: got slugs %v, want %v", op, got, want)
+	}
+}
+
+func testLinkListPages(t *testing.T, s store.Storage) {
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateUser(t, s, "bob@example.com")
+	mustCreateLink(t, s, "bob@example.com", "other")
+
+	wantSlugs(t, "empty", listSlugs(t, s, "alice@example.com", store.LinkQuery{Limit: 2}))
+
+	// Links created in the same millisecond tie on created_at and are
+	// ordered by slug.
+	at := now()
+	for _, slug := range []string{"e", "c", "a", "d", "b"} {
+		link := newLink(slug)
+		link.Created_at = at
+		if slug == "e" {
+			link.Created_at = at.Add(-time.Hour)
+		}
+		if err := s.Links.Create(context.Background(), "alice@example.com", link); err != nil {
+			t.Fatalf("Links.Create(%q): %v", slug, err)
+		}
+	}
+
+	wantSlugs(t, "ascending", listSlugs(t, s, "alice@example.com", store.LinkQuery{Limit: 2}), "e", "a", "b", "c", "d")
+	wantSlugs(t, "descending", listSlugs(t, s, "alice@example.com", store.LinkQuery{Limit: 2, Descending: true}), "d", "c", "b", "a", "e")
+	wantSlugs(t, "single page", listSlugs(t, s, "alice@example.com", store.LinkQuery{Limit: 5}), "e", "a", "b", "c", "d")
+}
+
+func testLinkListFilters(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+
+	at := now()
+	links := []*store.Link{
+		{Slug: "expired", OriginalUrl: "https://example.com/a", Created_at: at.Add(-3 * time.Hour), Expired_date: at.Add(-time.Hour)},
+		{Slug: "never", OriginalUrl: "https://Docs.example.com/b", Created_at: at.Add(-2 * time.Hour)},
+		{Slug: "soon", OriginalUrl: "https://example.com/docs", Created_at: at.Add(-time.Hour), Expired_date: at.Add(time.Hour)},
+	}
+	for _, link := range links {
+		if err := s.Links.Create(ctx, "alice@example.com", link); err != nil {
+			t.Fatalf("Links.Create(%q): %v", link.Slug, err)
+		}
+	}
+
+	list := func(query store.LinkQuery) []string {
+		query.Limit = 10
+		query.Now = at
+		return listSlugs(t, s, "alice@example.com", query)
+	}
+
+	wantSlugs(t, "active", list(store.LinkQuery{Status: store.LinkStatusActive}), "never", "soon")
+	wantSlugs(t, "expired", list(store.LinkQuery{Status: store.LinkStatusExpired}), "expired")
+	wantSlugs(t, "created after", list(store.LinkQuery{CreatedAfter: at.Add(-2 * time.Hour)}), "never", "soon")
+	wantSlugs(t, "created before", list(store.LinkQuery{CreatedBefore: at.Add(-2 * time.Hour)}), "expired")
+	wantSlugs(t, "search destination", list(store.LinkQuery{Search: "docs"}), "never", "soon")
+	wantSlugs(t, "search slug", list(store.LinkQuery{Search: "EXP"}), "expired")
+	wantSlugs(t, "search regexp", list(store.LinkQuery{Search: ".*"}))
+	wantSlugs(t, "sort by expiry", list(store.LinkQuery{Sort: store.LinkSortExpiredDate}), "never", "expired", "soon")
+}
+
+func testLinkListSortByClicks(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateLink(t, s, "alice@example.com", "none")
+	mustCreateLink(t, s, "alice@example.com", "many")
+	mustCreateLink(t, s, "alice@example.com", "few")
+
+	at := now()
+	clicks := []store.Click{
+		newClick("alice@example.com", "many", at),
+		newClick("alice@example.com", "many", at),
+		newClick("alice@example.com", "few", at),
+	}
+	if err := s.Clicks.CreateMany(ctx, clicks); err != nil {
+		t.Fatalf("Clicks.CreateMany: %v", err)
+	}
+	if err := s.Clicks.CreateMany(ctx, clicks[:1]); err != nil {
+		t.Fatalf("Clicks.CreateMany: %v", err)
+	}
+
+	link, err := s.Links.GetBySlug(ctx, "many")
+	if err != nil {
+		t.Fatalf("Links.GetBySlug: %v", err)
+	}
+	if link.Clicks != 3 {
+		t.Fatalf("got %d clicks, want 3", link.Clicks)
+	}
+
+	query := store.LinkQuery{Sort: store.LinkSortClicks, Descending: true, Limit: 1}
+	wantSlugs(t, "by clicks", listSlugs(t, s, "alice@example.com", query), "many", "few", "none")
+}
+
+func testLinkListInvalidCursor(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateLink(t, s, "alice@example.com", "first")
+	mustCreateLink(t, s, "alice@example.com", "second")
+
+	_, err := s.Links.List(ctx, "alice@example.com", store.LinkQuery{Limit: 1, Cursor: "not a cursor"})
+	wantErr(t, "Links.List malformed cursor", err, store.ErrInvalidCursor)
+
+	page, err := s.Links.List(ctx, "alice@example.com", store.LinkQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("Links.List: %v", err)
+	}
+	if page.NextCursor == "" {
+		t.Fatal("Links.List: want a next cursor")
+	}
+
+	_, err = s.Links.List(ctx, "alice@example.com", store.LinkQuery{Limit: 1, Cursor: page.NextCursor, Sort: store.LinkSortClicks})
+	wantErr(t, "Links.List cursor of another sort", err, store.ErrInvalidCursor)
+}
+
+func testLinkGetAllLinks(t *testing.T, s store.Storage) {
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateUser(t, s, "bob@example.com")
+	first := mustCreateLink(t, s, "alice@example.com", "first")
+	second := mustCreateLink(t, s, "bob@example.com", "second")
+
+	links, err := s.Links.GetAllLinks(context.Background())
+	if err != nil {
+		t.Fatalf("Links.GetAllLinks: %v", err)
+	}
+	if len(links) != 2 {
+		t.Fatalf("got %d links, want 2", len(links))
+	}
+	equalLink(t, &links[0], first)
+	equalLink(t, &links[1], second)
+}
+
+func testLinkDelete(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateLink(t, s, "alice@example.com", "abc123")
+
+	if err := s.Links.DeleteBySlug(ctx, "alice@example.com", "abc123"); err != nil {
+		t.Fatalf("Links.DeleteBySlug: %v", err)
+	}
+
+	_, err := s.Links.GetBySlug(ctx, "abc123")
+	wantErr(t, "Links.GetBySlug after delete", err, store.ErrNotFound)
+
+	err = s.Links.DeleteBySlug(ctx, "alice@example.com", "abc123")
+	wantErr(t, "Links.DeleteBySlug twice", err, store.ErrNotFound)
+
+	// A deleted slug can be claimed again.
+	mustCreateLink(t, s, "alice@example.com", "abc123")
+}
+
+func testLinkDeleteOtherUser(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateUser(t, s, "bob@example.com")
+	mustCreateLink(t, s, "alice@example.com", "abc123")
+
+	err := s.Links.DeleteBySlug(ctx, "bob@example.com", "abc123")
+	wantErr(t, "Links.DeleteBySlug other user", err, store.ErrNotFound)
+
+	if _, err := s.Links.GetBySlug(ctx, "abc123"); err != nil {
+		t.Fatalf("link was removed by another user: %v", err)
+	}
+}
+
+func testLinkUpdate(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+	link := mustCreateLink(t, s, "alice@example.com", "abc123")
+
+	link.OriginalUrl = "https://example.org/updated"
+	link.Expired_date = now().Add(time.Hour)
+	link.RedirectType = 307
+	if err := s.Links.UpdateBySlug(ctx, "alice@example.com", link); err != nil {
+		t.Fatalf("Links.UpdateBySlug: %v", err)
+	}
+
+	got, err := s.Links.GetBySlug(ctx, "abc123")
+	if err != nil {
+		t.Fatalf("Links.GetBySlug: %v", err)
+	}
+	equalLink(t, got, link)
+
+	// Expiry in the past is stored as-is; handlers decide what expired means.
+	link.Expired_date = now().Add(-time.Hour)
+	if err := s.Links.UpdateBySlug(ctx, "alice@example.com", link); err != nil {
+		t.Fatalf("Links.UpdateBySlug past expiry: %v", err)
+	}
+
+	got, err = s.Links.GetBySlug(ctx, "abc123")
+	if err != nil {
+		t.Fatalf("Links.GetBySlug: %v", err)
+	}
+	equalLink(t, got, link)
+}
+
+func testLinkNeverExpires(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+
+	link := newLink("forever")
+	link.Expired_date = time.Time{}
+	if err := s.Links.Create(ctx, "alice@example.com", link); err != nil {
+		t.Fatalf("Links.Create: %v", err)
+	}
+
+	got, err := s.Links.GetBySlug(ctx, "forever")
+	if err != nil {
+		t.Fatalf("Links.GetBySlug: %v", err)
+	}
+	if !got.Expired_date.IsZero() || got.IsExpired(now().AddDate(100, 0, 0)) {
+		t.Fatalf("got expired_date %v, want a link that never expires", got.Expired_date)
+	}
+}
+
+func testLinkRename(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+	link := mustCreateLink(t, s, "alice@example.com", "before")
+
+	if err := s.Clicks.CreateMany(ctx, []store.Click{newClick("alice@example.com", "before", now())}); err != nil {
+		t.Fatalf("Clicks.CreateMany: %v", err)
+	}
+
+	// The rename writes the other fields of the link along with the slug.
+	renamed := *link
+	renamed.Slug = "after"
+	renamed.OriginalUrl = "https://example.com/renamed"
+	renamed.RedirectType = 301
+	if err := s.Links.Rename(ctx, "alice@example.com", "before", &renamed, false); err != nil {
+		t.Fatalf("Links.Rename: %v", err)
+	}
+
+	_, err := s.Links.GetBySlug(ctx, "before")
+	wantErr(t, "Links.GetBySlug old slug", err, store.ErrNotFound)
+
+	got, err := s.Links.GetBySlug(ctx, "after")
+	if err != nil {
+		t.Fatalf("Links.GetBySlug new slug: %v", err)
+	}
+
+	equalLink(t, got, &renamed)
+	wantCount(t, s, "alice@example.com", "after", 1)
+
+	// The old slug is free again.
+	mustCreateLink(t, s, "alice@example.com", "before")
+}
+
+func testLinkRenameConflict(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateUser(t, s, "bob@example.com")
+	first := mustCreateLink(t, s, "alice@example.com", "first")
+	mustCreateLink(t, s, "alice@example.com", "second")
+	mustCreateLink(t, s, "bob@example.com", "bobs")
+
+	err := s.Links.Rename(ctx, "alice@example.com", "first", newLink("second"), false)
+	wantErr(t, "Links.Rename to own slug", err, store.ErrDuplicateSlug)
+
+	err = s.Links.Rename(ctx, "alice@example.com", "first", newLink("bobs"), false)
+	wantErr(t, "Links.Rename to other user's slug", err, store.ErrDuplicateSlug)
+
+	err = s.Links.Rename(ctx, "alice@example.com", "bobs", newLink("mine"), false)
+	wantErr(t, "Links.Rename other user's link", err, store.ErrNotFound)
+
+	err = s.Links.Rename(ctx, "alice@example.com", "missing", newLink("mine"), false)
+	wantErr(t, "Links.Rename unknown slug", err, store.ErrNotFound)
+
+	got, err := s.Links.GetBySlug(ctx, "first")
+	if err != nil {
+		t.Fatalf("failed rename changed the link: %v", err)
+	}
+	equalLink(t, got, first)
+}
+
+func testLinkRenameKeepAlias(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateLink(t, s, "alice@example.com", "one")
+
+	if err := s.Links.Rename(ctx, "alice@example.com", "one", newLink("two"), true); err != nil {
+		t.Fatalf("Links.Rename: %v", err)
+	}
+
+	alias, err := s.Links.GetBySlug(ctx, "one")
+	if err != nil {
+		t.Fatalf("Links.GetBySlug alias: %v", err)
+	}
+	if alias.AliasOf != "two" || alias.Owner != "alice@example.com" {
+		t.Fatalf("got alias of %q owned by %q, want alias of %q", alias.AliasOf, alias.Owner, "two")
+	}
+
+	// Renaming again keeps existing aliases pointing at the link.
+	if err := s.Links.Rename(ctx, "alice@example.com", "two", newLink("three"), true); err != nil {
+		t.Fatalf("Links.Rename again: %v", err)
+	}
+
+	for _, slug := range []string{"one", "two"} {
+		alias, err := s.Links.GetBySlug(ctx, slug)
+		if err != nil {
+			t.Fatalf("Links.GetBySlug %q: %v", slug, err)
+		}
+		if alias.AliasOf != "three" {
+			t.Fatalf("alias %q points at %q, want %q", slug, alias.AliasOf, "three")
+		}
+	}
+
+	target, err := s.Links.GetBySlug(ctx, "three")
+	if err != nil {
+		t.Fatalf("Links.GetBySlug target: %v", err)
+	}
+	if target.AliasOf != "" {
+		t.Fatalf("renamed link became an alias of %q", target.AliasOf)
+	}
+}
+
+func testLinkDeleteRemovesAliases(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateLink(t, s, "alice@example.com", "one")
+	mustCreateLink(t, s, "alice@example.com", "other")
+
+	if err := s.Links.Rename(ctx, "alice@example.com", "one", newLink("two"), true); err != nil {
+		t.Fatalf("Links.Rename: %v", err)
+	}
+
+	if err := s.Links.DeleteBySlug(ctx, "alice@example.com", "two"); err != nil {
+		t.Fatalf("Links.DeleteBySlug: %v", err)
+	}
+
+	_, err := s.Links.GetBySlug(ctx, "one")
+	wantErr(t, "Links.GetBySlug alias after delete", err, store.ErrNotFound)
+
+	if _, err := s.Links.GetBySlug(ctx, "other"); err != nil {
+		t.Fatalf("unrelated link was removed: %v", err)
+	}
+}
+
+func testLinkUpdateNotFound(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateUser(t, s, "bob@example.com")
+	mustCreateLink(t, s, "alice@example.com", "abc123")
+
+	err := s.Links.UpdateBySlug(ctx, "alice@example.com", newLink("missing"))
+	wantErr(t, "Links.UpdateBySlug unknown slug", err, store.ErrNotFound)
+
+	err = s.Links.UpdateBySlug(ctx, "bob@example.com", newLink("abc123"))
+	wantErr(t, "Links.UpdateBySlug other user", err, store.ErrNotFound)
+}
+
+func newClick(owner, slug string, at time.Time) store.Click {
+	return store.Click{
+		Slug:      slug,
+		Owner:     owner,
+		Timestamp: at,
+		Referrer:  "https://example.org",
+		UserAgent: "storetest",
+		IPHash:    "hash",
+		RequestID: "request",
+	}
+}
+
+func wantCount(t *testing.T, s store.Storage, owner, slug string, want int64) {
+	t.Helper()
+
+	got, err := s.Clicks.Count(context.Background(), owner, slug)
+	if err != nil {
+		t.Fatalf("Clicks.Count: %v", err)
+	}
+	if got != want {
+		t.Fatalf("Clicks.Count(%q, %q) = %d, want %d", owner, slug, got, want)
+	}
+}
+
+func testClickCount(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	at := now()
+
+	wantCount(t, s, "alice@example.com", "abc123", 0)
+
+	clicks := []store.Click{
+		newClick("alice@example.com", "abc123", at),
+		newClick("alice@example.com", "abc123", at),
+		newClick("alice@example.com", "other", at),
+		newClick("bob@example.com", "abc123", at),
+	}
+	if err := s.Clicks.CreateMany(ctx, clicks); err != nil {
+		t.Fatalf("Clicks.CreateMany: %v", err)
+	}
+
+	if err := s.Clicks.CreateMany(ctx, nil); err != nil {
+		t.Fatalf("Clicks.CreateMany empty: %v", err)
+	}
+
+	wantCount(t, s, "alice@example.com", "abc123", 2)
+	wantCount(t, s, "alice@example.com", "other", 1)
+	wantCount(t, s, "bob@example.com", "abc123", 1)
+}
+
+func testClickSeries(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	hour := now().Truncate(time.Hour)
+
+	clicks := []store.Click{
+		newClick("alice@example.com", "abc123", hour.Add(time.Minute)),
+		newClick("alice@example.com", "abc123", hour.Add(2*time.Minute)),
+		newClick("alice@example.com", "abc123", hour.Add(-time.Hour)),
+		newClick("alice@example.com", "abc123", hour.Add(-10*time.Hour)),
+		newClick("bob@example.com", "abc123", hour),
+	}
+	if err := s.Clicks.CreateMany(ctx, clicks); err != nil {
+		t.Fatalf("Clicks.CreateMany: %v", err)
+	}
+
+	hourly, err := s.Clicks.Series(ctx, "alice@example.com", "abc123", store.ClickHourly, hour.Add(-2*time.Hour))
+	if err != nil {
+		t.Fatalf("Clicks.Series hourly: %v", err)
+	}
+
+	want := []int64{0, 1, 2}
+	if len(hourly) != len(want) {
+		t.Fatalf("got %d hourly buckets, want %d", len(hourly), len(want))
+	}
+	for i, b := range hourly {
+		if !b.Time.Equal(hour.Add(time.Duration(i-2) * time.Hour)) {
+			t.Fatalf("hourly bucket %d starts at %v", i, b.Time)
+		}
+		if b.Count != want[i] {
+			t.Fatalf("hourly bucket %d: got %d clicks, want %d", i, b.Count, want[i])
+		}
+	}
+
+	daily, err := s.Clicks.Series(ctx, "alice@example.com", "abc123", store.ClickDaily, hour.AddDate(0, 0, -2))
+	if err != nil {
+		t.Fatalf("Clicks.Series daily: %v", err)
+	}
+	if len(daily) != 3 {
+		t.Fatalf("got %d daily buckets, want 3", len(daily))
+	}
+
+	var total int64
+	for _, b := range daily {
+		if b.Time.Hour() != 0 || b.Time.Minute() != 0 {
+			t.Fatalf("daily bucket %v does not start at midnight UTC", b.Time)
+		}
+		total += b.Count
+	}
+	if total != 4 {
+		t.Fatalf("got %d clicks over daily buckets, want 4", total)
+	}
+}
+
+func testClickDeletedWithLink(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateLink(t, s, "alice@example.com", "abc123")
+	mustCreateLink(t, s, "alice@example.com", "other")
+
+	clicks := []store.Click{
+		newClick("alice@example.com", "abc123", now()),
+		newClick("alice@example.com", "other", now()),
+	}
+	if err := s.Clicks.CreateMany(ctx, clicks); err != nil {
+		t.Fatalf("Clicks.CreateMany: %v", err)
+	}
+
+	if err := s.Links.DeleteBySlug(ctx, "alice@example.com", "abc123"); err != nil {
+		t.Fatalf("Links.DeleteBySlug: %v", err)
+	}
+	wantCount(t, s, "alice@example.com", "abc123", 0)
+	wantCount(t, s, "alice@example.com", "other", 1)
+
+	if err := s.Users.DeleteByEmail(ctx, "alice@example.com"); err != nil {
+		t.Fatalf("Users.DeleteByEmail: %v", err)
+	}
+	wantCount(t, s, "alice@example.com", "other", 0)
+}
+
+func mustCreateSession(t *testing.T, s store.Storage, id, hash string) *store.Session {
+	t.Helper()
+
+	session := &store.Session{
+		ID:           id,
+		Email:        "alice@example.com",
+		TokenHash:    hash,
+		Created_at:   now(),
+		Expired_date: now().Add(time.Hour),
+	}
+	if err := s.Sessions.Create(context.Background(), session); err != nil {
+		t.Fatalf("Sessions.Create: %v", err)
+	}
+
+	return session
+}
+
+func testSessionCreateAndGet(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	want := mustCreateSession(t, s, "session-1", "hash-1")
+
+	got, err := s.Sessions.GetByID(ctx, "session-1")
+	if err != nil {
+		t.Fatalf("Sessions.GetByID: %v", err)
+	}
+	if got.Email != want.Email || got.TokenHash != want.TokenHash || got.Revoked {
+		t.Fatalf("got session %+v, want %+v", got, want)
+	}
+	if !got.Expired_date.Equal(want.Expired_date) || !got.IsActive(now()) {
+		t.Fatalf("got expired_date %v, want active session until %v", got.Expired_date, want.Expired_date)
+	}
+
+	got, err = s.Sessions.GetByTokenHash(ctx, "hash-1")
+	if err != nil || got.ID != "session-1" {
+		t.Fatalf("Sessions.GetByTokenHash: got %v, %v", got, err)
+	}
+
+	_, err = s.Sessions.GetByID(ctx, "missing")
+	wantErr(t, "Sessions.GetByID unknown", err, store.ErrNotFound)
+
+	_, err = s.Sessions.GetByTokenHash(ctx, "missing")
+	wantErr(t, "Sessions.GetByTokenHash unknown", err, store.ErrNotFound)
+}
+
+func testSessionRotate(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateSession(t, s, "session-1", "hash-1")
+
+	if err := s.Sessions.Rotate(ctx, "session-1", "hash-1", "hash-2"); err != nil {
+		t.Fatalf("Sessions.Rotate: %v", err)
+	}
+
+	err := s.Sessions.Rotate(ctx, "session-1", "hash-1", "hash-3")
+	wantErr(t, "Sessions.Rotate with rotated token", err, store.ErrNotFound)
+
+	// A rotated token still leads to its session so reuse can be detected.
+	got, err := s.Sessions.GetByTokenHash(ctx, "hash-1")
+	if err != nil {
+		t.Fatalf("Sessions.GetByTokenHash rotated: %v", err)
+	}
+	if got.ID != "session-1" || got.TokenHash != "hash-2" {
+		t.Fatalf("got session %q with token %q, want session-1 with hash-2", got.ID, got.TokenHash)
+	}
+}
+
+func testSessionRotateCapsHistory(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateSession(t, s, "session-1", "hash-0")
+
+	rotations := store.MaxPreviousHashes + 5
+	for i := 0; i < rotations; i++ {
+		if err := s.Sessions.Rotate(ctx, "session-1", fmt.Sprintf("hash-%d", i), fmt.Sprintf("hash-%d", i+1)); err != nil {
+			t.Fatalf("Sessions.Rotate %d: %v", i, err)
+		}
+	}
+
+	got, err := s.Sessions.GetByID(ctx, "session-1")
+	if err != nil {
+		t.Fatalf("Sessions.GetByID: %v", err)
+	}
+	if len(got.PreviousHashes) != store.MaxPreviousHashes {
+		t.Fatalf("got %d previous hashes, want %d", len(got.PreviousHashes), store.MaxPreviousHashes)
+	}
+
+	// The most recent tokens are kept, the oldest are forgotten.
+	latest := fmt.Sprintf("hash-%d", rotations-1)
+	if got.PreviousHashes[len(got.PreviousHashes)-1] != latest {
+		t.Fatalf("got last previous hash %q, want %q", got.PreviousHashes[len(got.PreviousHashes)-1], latest)
+	}
+	if _, err := s.Sessions.GetByTokenHash(ctx, latest); err != nil {
+		t.Fatalf("Sessions.GetByTokenHash recent: %v", err)
+	}
+
+	_, err = s.Sessions.GetByTokenHash(ctx, "hash-0")
+	wantErr(t, "Sessions.GetByTokenHash forgotten", err, store.ErrNotFound)
+}
+
+func testSessionRevoke(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateSession(t, s, "session-1", "hash-1")
+
+	if err := s.Sessions.Revoke(ctx, "session-1"); err != nil {
+		t.Fatalf("Sessions.Revoke: %v", err)
+	}
+
+	got, err := s.Sessions.GetByID(ctx, "session-1")
+	if err != nil {
+		t.Fatalf("Sessions.GetByID: %v", err)
+	}
+	if !got.Revoked || got.IsActive(now()) {
+		t.Fatal("revoked session is still active")
+	}
+
+	err = s.Sessions.Rotate(ctx, "session-1", "hash-1", "hash-2")
+	wantErr(t, "Sessions.Rotate revoked", err, store.ErrNotFound)
+
+	err = s.Sessions.Revoke(ctx, "missing")
+	wantErr(t, "Sessions.Revoke unknown", err, store.ErrNotFound)
+}
+
+func mustCreateAPIKey(t *testing.T, s store.Storage, owner, id string) *store.APIKey {
+	t.Helper()
+
+	key := &store.APIKey{
+		ID:         id,
+		Owner:      owner,
+		Name:       "ci",
+		Prefix:     "lsk_" + id,
+		Hash:       "hash-" + id,
+		Scopes:     []string{"links:read"},
+		Created_at: now(),
+	}
+	if err := s.APIKeys.Create(context.Background(), key); err != nil {
+		t.Fatalf("APIKeys.Create: %v", err)
+	}
+
+	return key
+}
+
+func testAPIKeyLifecycle(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateAPIKey(t, s, "alice@example.com", "key-1")
+	mustCreateAPIKey(t, s, "alice@example.com", "key-2")
+	mustCreateAPIKey(t, s, "bob@example.com", "key-3")
+
+	key, err := s.APIKeys.GetByHash(ctx, "hash-key-1")
+	if err != nil {
+		t.Fatalf("APIKeys.GetByHash: %v", err)
+	}
+	if key.ID != "key-1" || key.Owner != "alice@example.com" || !key.HasScope("links:read") || key.HasScope("links:write") {
+		t.Fatalf("got key %+v", key)
+	}
+	if !key.IsActive(now()) {
+		t.Fatal("new key without expiry is not active")
+	}
+
+	_, err = s.APIKeys.GetByHash(ctx, "missing")
+	wantErr(t, "APIKeys.GetByHash unknown", err, store.ErrNotFound)
+
+	keys, err := s.APIKeys.GetAll(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatalf("APIKeys.GetAll: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(keys))
+	}
+
+	used := now()
+	if err := s.APIKeys.TouchLastUsed(ctx, "key-1", used); err != nil {
+		t.Fatalf("APIKeys.TouchLastUsed: %v", err)
+	}
+	if err := s.APIKeys.TouchLastUsed(ctx, "key-1", used.Add(-time.Hour)); err != nil {
+		t.Fatalf("APIKeys.TouchLastUsed older: %v", err)
+	}
+
+	key, err = s.APIKeys.GetByHash(ctx, "hash-key-1")
+	if err != nil {
+		t.Fatalf("APIKeys.GetByHash: %v", err)
+	}
+	if !key.LastUsed_at.Equal(used) {
+		t.Fatalf("got last_used_at %v, want %v", key.LastUsed_at, used)
+	}
+
+	err = s.APIKeys.Revoke(ctx, "bob@example.com", "key-1")
+	wantErr(t, "APIKeys.Revoke other user's key", err, store.ErrNotFound)
+
+	if err := s.APIKeys.Revoke(ctx, "alice@example.com", "key-1"); err != nil {
+		t.Fatalf("APIKeys.Revoke: %v", err)
+	}
+
+	key, err = s.APIKeys.GetByHash(ctx, "hash-key-1")
+	if err != nil {
+		t.Fatalf("APIKeys.GetByHash: %v", err)
+	}
+	if key.IsActive(now()) {
+		t.Fatal("revoked key is still active")
+	}
+}
+
+func testAPIKeyDeletedWithUser(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	mustCreateUser(t, s, "alice@example.com")
+	mustCreateAPIKey(t, s, "alice@example.com", "key-1")
+
+	if err := s.Users.DeleteByEmail(ctx, "alice@example.com"); err != nil {
+		t.Fatalf("Users.DeleteByEmail: %v", err)
+	}
+
+	_, err := s.APIKeys.GetByHash(ctx, "hash-key-1")
+	wantErr(t, "APIKeys.GetByHash after owner delete", err, store.ErrNotFound)
+}
+
+func testHealthPing(t *testing.T, s store.Storage) {
+	if err := s.Health.Ping(context.Background()); err != nil {
+		t.Fatalf("Health.Ping: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := s.Health.Ping(ctx); err == nil {
+		t.Fatal("Health.Ping with a canceled context: got no error")
+	}
+}
@@ -12,10 +12,26 @@ import (
 
 type User struct {
 	Username   string    `bson:"username" json:"username"`
-	Password   []byte    `bson:"password" json:"password"`
+	Password   []byte    `bson:"password" json:"-"`
 	Email      string    `bson:"email" json:"email"`
 	Created_at time.Time `bson:"created_at" json:"created_at"`
-	Links      []Link    `bson:"links" json:"links"`
+	Role       string    `bson:"role,omitempty" json:"role"`
+	Suspended  bool      `bson:"suspended,omitempty" json:"suspended"`
+}
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// HasRole reports whether the user has role. Users created before roles
+// existed have no role stored and are treated as regular users.
+func (u *User) HasRole(role string) bool {
+	if u.Role == "" {
+		return role == RoleUser
+	}
+
+	return u.Role == role
 }
 
 type UserStore struct {
@@ -41,13 +57,9 @@ func (s *UserStore) Create(ctx context.Context, user *User) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	if _, err := s.GetByEmail(ctx, user.Email); err == nil {
-		return ErrDuplicateEmail
-	}
-
 	_, err := s.db.Database(DB).Collection(Collection).InsertOne(ctx, user)
 	if err != nil {
-		return err
+		return duplicateKeyError(err)
 	}
 
 	return nil
@@ -65,6 +77,30 @@ func (s *UserStore) Update(ctx context.Context, user *User) error {
 	}
 
 	result, err := s.db.Database(DB).Collection(Collection).UpdateOne(ctx, filter, updateData)
+	if err != nil {
+		return duplicateKeyError(err)
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *UserStore) SetRole(ctx context.Context, email string, role string) error {
+	return s.set(ctx, email, bson.M{"role": role})
+}
+
+func (s *UserStore) SetSuspended(ctx context.Context, email string, suspended bool) error {
+	return s.set(ctx, email, bson.M{"suspended": suspended})
+}
+
+func (s *UserStore) set(ctx context.Context, email string, fields bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.Database(DB).Collection(Collection).UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": fields})
 	if err != nil {
 		return err
 	}
@@ -86,12 +122,17 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 		"email":      1,
 		"password":   1,
 		"created_at": 1,
+		"role":       1,
+		"suspended":  1,
 	}
 	options := options.FindOne().SetProjection(projection)
 
 	var result User
 	err := s.db.Database(DB).Collection(Collection).FindOne(ctx, filter, options).Decode(&result)
 	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
 		return nil, err
 	}
 
@@ -113,6 +154,26 @@ func (s *UserStore) DeleteByEmail(ctx context.Context, email string) error {
 		return ErrNotFound
 	}
 
+	_, err = s.db.Database(DB).Collection(LinkCollection).DeleteMany(ctx, bson.M{"owner": email})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Database(DB).Collection(ClickCollection).DeleteMany(ctx, bson.M{"owner": email})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Database(DB).Collection(APIKeyCollection).DeleteMany(ctx, bson.M{"owner": email})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Database(DB).Collection(SessionCollection).DeleteMany(ctx, bson.M{"email": email})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -120,13 +181,15 @@ func (s *UserStore) GetAllUsers(ctx context.Context) ([]User, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	cursor, err := s.db.Database(DB).Collection(Collection).Find(ctx, bson.M{})
+	options := options.Find().SetProjection(bson.M{"links": 0})
+
+	cursor, err := s.db.Database(DB).Collection(Collection).Find(ctx, bson.M{}, options)
 	if err != nil {
 		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	var users []User
+	users := []User{}
 	if err = cursor.All(ctx, &users); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,108 @@
+// Package urlcheck validates and normalizes the destination URLs of links.
+package urlcheck
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	CodeRequired       = "url_required"
+	CodeInvalid        = "url_invalid"
+	CodeScheme         = "url_scheme_not_allowed"
+	CodeHost           = "url_host_invalid"
+	CodeCredentials    = "url_credentials_not_allowed"
+	CodeSelfReferenced = "url_self_referencing"
+)
+
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// scheme matches a leading URI scheme. A scheme followed by digits is really a
+// host and port, e.g. "example.com:8080/path".
+var scheme = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*):([^0-9]|$)`)
+
+type Normalizer struct {
+	blocked map[string]bool
+}
+
+// NewNormalizer returns a Normalizer that rejects URLs pointing at any of
+// hosts. Hosts may carry a port, in which case only that port is rejected.
+func NewNormalizer(hosts ...string) *Normalizer {
+	blocked := make(map[string]bool)
+	for _, host := range hosts {
+		if host = strings.TrimSpace(host); host != "" {
+			blocked[strings.ToLower(host)] = true
+		}
+	}
+
+	return &Normalizer{blocked}
+}
+
+// Normalize returns raw as an absolute http(s) URL with an ASCII, lower-cased
+// host. A missing scheme defaults to https.
+func (n *Normalizer) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", &Error{CodeRequired, "original_url is required"}
+	}
+
+	if !strings.Contains(raw, "://") {
+		if m := scheme.FindStringSubmatch(raw); m != nil {
+			return "", &Error{CodeScheme, "scheme " + strings.ToLower(m[1]) + " is not allowed, use http or https"}
+		}
+		raw = "https://" + strings.TrimPrefix(raw, "//")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", &Error{CodeInvalid, "original_url is not a valid URL"}
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", &Error{CodeScheme, "scheme " + u.Scheme + " is not allowed, use http or https"}
+	}
+
+	if u.User != nil {
+		return "", &Error{CodeCredentials, "original_url must not contain credentials"}
+	}
+
+	hostname := u.Hostname()
+	if hostname == "" {
+		return "", &Error{CodeHost, "original_url has no host"}
+	}
+
+	if net.ParseIP(hostname) == nil {
+		ascii, err := idna.Lookup.ToASCII(strings.TrimSuffix(hostname, "."))
+		if err != nil || !strings.Contains(ascii, ".") && ascii != "localhost" {
+			return "", &Error{CodeHost, "original_url has an invalid host"}
+		}
+		hostname = ascii
+	}
+
+	host := hostname
+	if strings.Contains(hostname, ":") {
+		host = "[" + hostname + "]"
+	}
+	if port := u.Port(); port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	if n.blocked[strings.ToLower(hostname)] || n.blocked[strings.ToLower(host)] {
+		return "", &Error{CodeSelfReferenced, "original_url must not point to this link shortener"}
+	}
+
+	return u.String(), nil
+}
@@ -0,0 +1,264 @@
+// Package validate checks struct fields against rules declared in their
+// `validate` tags, e.g. `validate:"required,email,max=254"`.
+//
+// Fields are reported under their JSON name. Every rule except required
+// skips zero values, so optional fields only have to be valid when they are
+// set. Embedded structs without a JSON name are validated as if their fields
+// belonged to the outer struct.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	CodeRequired     = "field_required"
+	CodeTooShort     = "field_too_short"
+	CodeTooLong      = "field_too_long"
+	CodeTooSmall     = "field_too_small"
+	CodeTooLarge     = "field_too_large"
+	CodeNotAllowed   = "field_not_allowed"
+	CodeEmailInvalid = "email_invalid"
+)
+
+// FieldError describes what is wrong with a single field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Message
+}
+
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Message
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Has reports whether any error was reported for field.
+func (e Errors) Has(field string) bool {
+	for _, err := range e {
+		if err.Field == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Rule checks a non-zero field value. param is the text after "=" in the tag,
+// if any. A nil return means the value is valid.
+type Rule func(field string, value reflect.Value, param string) *FieldError
+
+type Validator struct {
+	rules map[string]Rule
+}
+
+// New returns a Validator that knows the rules required, email, min, max and
+// oneof.
+func New() *Validator {
+	return &Validator{
+		rules: map[string]Rule{
+			"email": email,
+			"min":   minimum,
+			"max":   maximum,
+			"oneof": oneOf,
+		},
+	}
+}
+
+// Register adds a rule under name, replacing any rule with the same name.
+func (v *Validator) Register(name string, rule Rule) {
+	v.rules[name] = rule
+}
+
+// Struct validates s, a struct or a pointer to one, and returns every field
+// that breaks its rules. Only the first broken rule of each field is reported.
+func (v *Validator) Struct(s any) Errors {
+	value := reflect.Indirect(reflect.ValueOf(s))
+	if value.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validate: Struct called with %T", s))
+	}
+
+	var errs Errors
+	v.walk(value, &errs)
+
+	return errs
+}
+
+func (v *Validator) walk(s reflect.Value, errs *Errors) {
+	t := s.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			v.walk(s.Field(i), errs)
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		if err := v.field(name, s.Field(i), f.Tag.Get("validate")); err != nil {
+			*errs = append(*errs, *err)
+		}
+	}
+}
+
+func (v *Validator) field(name string, value reflect.Value, tag string) *FieldError {
+	if tag == "" {
+		return nil
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		rule, param, _ := strings.Cut(rule, "=")
+
+		if rule == "required" {
+			if value.IsZero() {
+				return &FieldError{name, CodeRequired, name + " is required"}
+			}
+			continue
+		}
+
+		check, ok := v.rules[rule]
+		if !ok {
+			panic(fmt.Sprintf("validate: unknown rule %q on field %s", rule, name))
+		}
+
+		if value.IsZero() {
+			continue
+		}
+
+		if err := check(name, reflect.Indirect(value), param); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func email(field string, value reflect.Value, _ string) *FieldError {
+	s := value.String()
+
+	// ParseAddress also accepts display names and comments, only a bare
+	// address with a dotted domain is a valid email here.
+	addr, err := mail.ParseAddress(s)
+	if err == nil && addr.Address == s {
+		if _, domain, _ := strings.Cut(s, "@"); strings.Contains(domain, ".") {
+			return nil
+		}
+	}
+
+	return &FieldError{field, CodeEmailInvalid, field + " must be a valid email address"}
+}
+
+func minimum(field string, value reflect.Value, param string) *FieldError {
+	n := mustInt(field, param)
+
+	switch value.Kind() {
+	case reflect.String:
+		if utf8.RuneCountInString(value.String()) < n {
+			return &FieldError{field, CodeTooShort, fmt.Sprintf("%s must be at least %d characters", field, n)}
+		}
+	case reflect.Slice, reflect.Map:
+		if value.Len() < n {
+			return &FieldError{field, CodeTooShort, fmt.Sprintf("%s must have at least %d items", field, n)}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value.Int() < int64(n) {
+			return &FieldError{field, CodeTooSmall, fmt.Sprintf("%s must be at least %d", field, n)}
+		}
+	default:
+		panic(fmt.Sprintf("validate: min does not support %s field %s", value.Kind(), field))
+	}
+
+	return nil
+}
+
+func maximum(field string, value reflect.Value, param string) *FieldError {
+	n := mustInt(field, param)
+
+	switch value.Kind() {
+	case reflect.String:
+		if utf8.RuneCountInString(value.String()) > n {
+			return &FieldError{field, CodeTooLong, fmt.Sprintf("%s must be at most %d characters", field, n)}
+		}
+	case reflect.Slice, reflect.Map:
+		if value.Len() > n {
+			return &FieldError{field, CodeTooLong, fmt.Sprintf("%s must have at most %d items", field, n)}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value.Int() > int64(n) {
+			return &FieldError{field, CodeTooLarge, fmt.Sprintf("%s must be at most %d", field, n)}
+		}
+	default:
+		panic(fmt.Sprintf("validate: max does not support %s field %s", value.Kind(), field))
+	}
+
+	return nil
+}
+
+// oneOf checks a string, or every string of a slice, against the space
+// separated values in param.
+func oneOf(field string, value reflect.Value, param string) *FieldError {
+	allowed := strings.Fields(param)
+
+	check := func(s string) bool {
+		for _, a := range allowed {
+			if s == a {
+				return true
+			}
+		}
+		return false
+	}
+
+	valid := true
+	switch value.Kind() {
+	case reflect.String:
+		valid = check(value.String())
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			valid = valid && check(value.Index(i).String())
+		}
+	default:
+		panic(fmt.Sprintf("validate: oneof does not support %s field %s", value.Kind(), field))
+	}
+
+	if !valid {
+		return &FieldError{field, CodeNotAllowed, fmt.Sprintf("%s must be one of %s", field, strings.Join(allowed, ", "))}
+	}
+
+	return nil
+}
+
+func mustInt(field, param string) int {
+	n, err := strconv.Atoi(param)
+	if err != nil {
+		panic(fmt.Sprintf("validate: invalid parameter %q on field %s", param, field))
+	}
+
+	return n
+}
@@ -0,0 +1,116 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+)
+
+type Embedded struct {
+	Note string `json:"note" validate:"max=5"`
+}
+
+type payload struct {
+	Username string   `json:"username" validate:"required,min=3,max=8"`
+	Email    string   `json:"email" validate:"required,email"`
+	Age      int      `json:"age" validate:"min=18,max=130"`
+	Role     string   `json:"role" validate:"oneof=user admin"`
+	Scopes   []string `json:"scopes" validate:"min=1,max=2,oneof=read write"`
+	Nick     *string  `json:"nick,omitempty" validate:"min=2"`
+	Unnamed  string   `validate:"max=3"`
+	Ignored  string   `json:"-" validate:"required"`
+	Embedded
+}
+
+func valid() payload {
+	return payload{Username: "alice", Email: "alice@example.com", Age: 30, Role: "user"}
+}
+
+func TestStruct(t *testing.T) {
+	one := "x"
+
+	tests := []struct {
+		name   string
+		modify func(p *payload)
+		field  string
+		code   string
+	}{
+		{"valid", func(p *payload) {}, "", ""},
+		{"optional fields left empty", func(p *payload) { p.Age, p.Role = 0, "" }, "", ""},
+
+		{"required missing", func(p *payload) { p.Username = "" }, "username", CodeRequired},
+		{"string too short", func(p *payload) { p.Username = "al" }, "username", CodeTooShort},
+		{"string too long", func(p *payload) { p.Username = "alexandria" }, "username", CodeTooLong},
+		{"length counts runes", func(p *payload) { p.Username = "ééééé" }, "", ""},
+		{"int too small", func(p *payload) { p.Age = 17 }, "age", CodeTooSmall},
+		{"int too large", func(p *payload) { p.Age = 131 }, "age", CodeTooLarge},
+		{"string not allowed", func(p *payload) { p.Role = "root" }, "role", CodeNotAllowed},
+		{"slice too long", func(p *payload) { p.Scopes = []string{"read", "write", "read"} }, "scopes", CodeTooLong},
+		{"slice item not allowed", func(p *payload) { p.Scopes = []string{"read", "delete"} }, "scopes", CodeNotAllowed},
+		{"pointer checked through", func(p *payload) { p.Nick = &one }, "nick", CodeTooShort},
+		{"field without json name", func(p *payload) { p.Unnamed = "long" }, "Unnamed", CodeTooLong},
+		{"embedded field", func(p *payload) { p.Note = "too long" }, "note", CodeTooLong},
+
+		{"email with display name", func(p *payload) { p.Email = "Alice <alice@example.com>" }, "email", CodeEmailInvalid},
+		{"email without dotted domain", func(p *payload) { p.Email = "alice@localhost" }, "email", CodeEmailInvalid},
+		{"email without at", func(p *payload) { p.Email = "alice.example.com" }, "email", CodeEmailInvalid},
+	}
+
+	v := New()
+	for _, tt := range tests {
+		p := valid()
+		tt.modify(&p)
+
+		errs := v.Struct(&p)
+
+		if tt.code == "" {
+			if len(errs) > 0 {
+				t.Errorf("%s: got errors %v, want none", tt.name, errs)
+			}
+			continue
+		}
+
+		if len(errs) != 1 || errs[0].Field != tt.field || errs[0].Code != tt.code {
+			t.Errorf("%s: got %+v, want one %s error on %s", tt.name, errs, tt.code, tt.field)
+		}
+	}
+}
+
+func TestStructReportsFirstBrokenRulePerField(t *testing.T) {
+	errs := New().Struct(&payload{Username: "a", Age: 200})
+
+	want := Errors{
+		{"username", CodeTooShort, "username must be at least 3 characters"},
+		{"email", CodeRequired, "email is required"},
+		{"age", CodeTooLarge, "age must be at most 130"},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Fatalf("got %+v, want %+v", errs, want)
+	}
+
+	if !errs.Has("email") || errs.Has("role") {
+		t.Fatalf("Has reports the wrong fields for %+v", errs)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	v := New()
+	v.Register("even", func(field string, value reflect.Value, _ string) *FieldError {
+		if value.Int()%2 != 0 {
+			return &FieldError{field, "field_odd", field + " must be even"}
+		}
+		return nil
+	})
+
+	type counter struct {
+		Count int `json:"count" validate:"even"`
+	}
+
+	if errs := v.Struct(counter{2}); len(errs) > 0 {
+		t.Fatalf("got errors %v for an even count", errs)
+	}
+
+	errs := v.Struct(counter{3})
+	if len(errs) != 1 || errs[0].Code != "field_odd" {
+		t.Fatalf("got %+v, want one field_odd error", errs)
+	}
+}